@@ -0,0 +1,63 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"time"
+)
+
+// reasonBannerRead — причина завершения сеанса в режиме --banner-only.
+const reasonBannerRead = "banner read"
+
+// printBanner читает приветствие сервера и выводит его в STDOUT, ничего
+// не отправляя, кроме отказов от опций Telnet. Чтение заканчивается, когда
+// сервер молчит дольше --banner-quiet, присылает --banner-max байт или
+// закрывает соединение. Первого байта ждём не дольше --timeout.
+func printBanner(conn net.Conn, cfg *Config) (string, error) {
+	parser := telnetParser{keepNulls: cfg.KeepNulls}
+	banner := make([]byte, 0, cfg.BannerMax)
+	buf := make([]byte, 1024)
+
+	wait := cfg.Timeout
+	if wait == 0 {
+		wait = cfg.BannerQuiet
+	}
+
+	for len(banner) < cfg.BannerMax {
+		if err := conn.SetReadDeadline(time.Now().Add(wait)); err != nil {
+			return "", fmt.Errorf("failed to set read deadline: %w", err)
+		}
+		wait = cfg.BannerQuiet
+
+		n, err := conn.Read(buf)
+		if n > 0 {
+			data, reply := parser.parse(buf[:n])
+			banner = append(banner, data...)
+			if len(reply) > 0 {
+				if _, err := conn.Write(reply); err != nil {
+					return "", fmt.Errorf("failed to answer negotiation: %w", err)
+				}
+			}
+		}
+
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() || err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to read banner: %w", err)
+		}
+	}
+
+	if len(banner) > cfg.BannerMax {
+		banner = banner[:cfg.BannerMax]
+	}
+	if _, err := os.Stdout.Write(banner); err != nil {
+		return "", outputError(err)
+	}
+
+	return reasonBannerRead, nil
+}
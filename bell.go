@@ -0,0 +1,36 @@
+package main
+
+// charBEL — управляющий символ звонка терминала.
+const charBEL byte = 0x07
+
+// bellFilter убирает или заменяет BEL в выводе сервера. Он получает уже
+// разобранные данные, без команд Telnet, так что байт 0x07 в них — всегда
+// звонок, а не номер опции.
+type bellFilter struct {
+	strip bool
+	to    byte
+}
+
+// filter обрабатывает очередной фрагмент на месте и возвращает результат.
+func (f *bellFilter) filter(chunk []byte) []byte {
+	out := chunk[:0]
+	for _, b := range chunk {
+		if b == charBEL {
+			if f.strip {
+				continue
+			}
+			b = f.to
+		}
+		out = append(out, b)
+	}
+	return out
+}
+
+// newBellFilter возвращает фильтр для --no-bell или --bell-to либо nil,
+// если BEL выводится как есть.
+func newBellFilter(cfg *Config) *bellFilter {
+	if !cfg.NoBell && !cfg.RemapBell {
+		return nil
+	}
+	return &bellFilter{strip: cfg.NoBell, to: cfg.BellTo}
+}
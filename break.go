@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"time"
+)
+
+// serialBreak — длительность сигнала BREAK на последовательной линии.
+const serialBreak = 250 * time.Millisecond
+
+// sendBreak посылает серверу BREAK: IAC BRK, который консольный сервер
+// переводит в BREAK на своей последовательной линии, а в режиме --serial —
+// настоящий BREAK на линии длительностью serialBreak.
+func sendBreak(conn net.Conn) error {
+	if c, ok := conn.(*serialConn); ok {
+		if err := c.Break(serialBreak); err != nil {
+			return fmt.Errorf("failed to send break: %w", err)
+		}
+		return nil
+	}
+
+	if _, err := conn.Write([]byte{cmdIAC, cmdBRK}); err != nil {
+		return fmt.Errorf("failed to send break: %w", err)
+	}
+	return nil
+}
+
+// breaker каждые interval посылает BREAK и отмечает это в STDERR.
+// Неудачная отправка завершает сеанс с ошибкой через fail.
+func breaker(conn net.Conn, interval time.Duration, stop <-chan struct{}, fail func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case t := <-ticker.C:
+			if err := sendBreak(conn); err != nil {
+				fail(err)
+				return
+			}
+			fmt.Fprintf(os.Stderr, "%s break sent\n", t.Format(time.RFC3339Nano))
+		}
+	}
+}
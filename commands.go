@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// reasonCommandsDone — причина завершения сеанса с --exit-after-commands.
+const reasonCommandsDone = "commands done"
+
+// stringList — значение повторяемого строкового флага.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ", ")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// sendCommands отправляет строки --command в том порядке, в котором они
+// заданы. Перед каждой строкой с --wait-prompt ждём приглашения, после
+// каждой выдерживаем --command-delay. С --exit-after-commands после последней
+// строки дополнительно ждём приглашения (или паузы), чтобы успел прийти её вывод.
+// Ввод STDIN пересылается только после того, как все команды отправлены.
+func sendCommands(conn net.Conn, cfg *Config, prompt *promptDetector) error {
+	for _, command := range cfg.Commands {
+		if err := waitPrompt(prompt, cfg); err != nil {
+			return err
+		}
+
+		line := []byte(command + "\r\n")
+		if !cfg.Raw {
+			line = escapeIAC(line)
+		}
+		if _, err := conn.Write(line); err != nil {
+			return fmt.Errorf("failed to send command %q: %w", command, err)
+		}
+
+		time.Sleep(cfg.CommandDelay)
+	}
+
+	if cfg.ExitAfterCommands && prompt != nil {
+		return waitPrompt(prompt, cfg)
+	}
+	return nil
+}
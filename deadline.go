@@ -0,0 +1,28 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"time"
+)
+
+// writeTimeoutConn ограничивает каждую запись в соединение сроком timeout,
+// чтобы застрявший сервер не мог навсегда заблокировать отправку.
+type writeTimeoutConn struct {
+	net.Conn
+	timeout time.Duration
+}
+
+func (c *writeTimeoutConn) Write(p []byte) (int, error) {
+	if err := c.Conn.SetWriteDeadline(time.Now().Add(c.timeout)); err != nil {
+		return 0, fmt.Errorf("failed to set write deadline: %w", err)
+	}
+
+	n, err := c.Conn.Write(p)
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		return n, fmt.Errorf("write to server timed out after %v: %w", c.timeout, err)
+	}
+	return n, err
+}
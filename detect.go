@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// detectTelnetWindow — сколько первых байт от сервера просматривает --detect-telnet.
+const detectTelnetWindow = 512
+
+// detectTelnetLimit — жёсткая граница просмотра: команда согласования
+// (IAC, глагол, опция), начатая в конце окна, досматривается до конца.
+const detectTelnetLimit = detectTelnetWindow + 2
+
+// telnetDetector ищет в начале потока переговоры Telnet (IAC WILL, WONT,
+// DO, DONT или SB), чтобы в режиме --raw предупредить, что на другом
+// конце, похоже, telnet-сервер. Поведение сеанса он не меняет. Разбор
+// здесь короче, чем в telnetParser: достаточно найти первую команду
+// согласования, а содержимое субпереговоров не нужно.
+type telnetDetector struct {
+	seen  int
+	state int
+	verb  byte
+	done  bool
+}
+
+// feed просматривает очередной фрагмент и печатает предупреждение в STDERR
+// при первом найденном согласовании.
+func (d *telnetDetector) feed(p []byte) {
+	if d.done {
+		return
+	}
+	// Окно ограничено всегда, даже посреди незаконченной команды.
+	if rest := detectTelnetLimit - d.seen; len(p) > rest {
+		p = p[:rest]
+	}
+	d.seen += len(p)
+
+	for _, b := range p {
+		switch d.state {
+		case stateData:
+			if b == cmdIAC {
+				d.state = stateIAC
+			}
+		case stateIAC:
+			switch b {
+			case cmdWILL, cmdWONT, cmdDO, cmdDONT, cmdSB:
+				d.verb = b
+				d.state = stateOption
+			default:
+				d.state = stateData
+			}
+		case stateOption:
+			d.done = true
+			fmt.Fprintf(os.Stderr, "warning: the server sent telnet negotiation (IAC %s %s); it looks like a telnet server, consider running without --raw\n",
+				verbName(d.verb), optionName(b))
+			return
+		}
+	}
+	if d.seen >= detectTelnetLimit {
+		d.done = true
+	}
+}
+
+// verbName возвращает имя команды переговоров.
+func verbName(verb byte) string {
+	switch verb {
+	case cmdWILL:
+		return "WILL"
+	case cmdWONT:
+		return "WONT"
+	case cmdDO:
+		return "DO"
+	case cmdDONT:
+		return "DONT"
+	case cmdSB:
+		return "SB"
+	}
+	return fmt.Sprint(verb)
+}
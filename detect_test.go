@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+// detectWarning прогоняет фрагменты через telnetDetector и возвращает
+// напечатанное в STDERR.
+func detectWarning(t *testing.T, chunks [][]byte) (string, *telnetDetector) {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stderr := os.Stderr
+	os.Stderr = w
+	defer func() { os.Stderr = stderr }()
+
+	d := &telnetDetector{}
+	for _, chunk := range chunks {
+		d.feed(chunk)
+	}
+	w.Close()
+	out, _ := io.ReadAll(r)
+	return string(out), d
+}
+
+func TestTelnetDetector(t *testing.T) {
+	window := bytes.Repeat([]byte{'x'}, detectTelnetWindow)
+	tests := []struct {
+		name   string
+		chunks [][]byte
+		want   string // ожидаемая команда в предупреждении, "" — без него
+	}{
+		{"plain data", [][]byte{[]byte("login: ")}, ""},
+		{"DO", [][]byte{{cmdIAC, cmdDO, 24}}, "IAC DO TTYPE"},
+		{"WILL split", [][]byte{{'a', cmdIAC}, {cmdWILL}, {1}}, "IAC WILL ECHO"},
+		{"SB", [][]byte{{cmdIAC, cmdSB, 24, 1}}, "IAC SB TTYPE"},
+		{"escaped IAC", [][]byte{{cmdIAC, cmdIAC, cmdDO}}, ""},
+		{"other command", [][]byte{{cmdIAC, cmdNOP, 1}}, ""},
+		{"at the end of the window", [][]byte{window[2:], {cmdIAC, cmdDO, 1}}, "IAC DO ECHO"},
+		{"after the window", [][]byte{window, {'x', cmdIAC, cmdDO, 1}}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _ := detectWarning(t, tt.chunks)
+			if tt.want == "" && got != "" {
+				t.Errorf("unexpected warning %q", got)
+			}
+			if tt.want != "" && !strings.Contains(got, tt.want) {
+				t.Errorf("warning %q, want it to mention %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTelnetDetectorStopsAfterWindow(t *testing.T) {
+	// Команда, начатая на границе окна, не продлевает просмотр.
+	chunk := append([]byte{cmdIAC}, bytes.Repeat([]byte{'x'}, 4*detectTelnetWindow)...)
+	prefix := bytes.Repeat([]byte{'x'}, detectTelnetWindow-1)
+	_, d := detectWarning(t, [][]byte{prefix, chunk})
+	if !d.done {
+		t.Errorf("detector still running after %d bytes", d.seen)
+	}
+	if d.seen > detectTelnetLimit {
+		t.Errorf("detector inspected %d bytes, limit is %d", d.seen, detectTelnetLimit)
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// outputTail хранит последние max байт вывода сервера для --dump-on-error.
+type outputTail struct {
+	max int
+	buf []byte
+}
+
+func newOutputTail(max int) *outputTail {
+	return &outputTail{max: max, buf: make([]byte, 0, max)}
+}
+
+// write добавляет p, отбрасывая самые старые байты сверх max.
+func (t *outputTail) write(p []byte) {
+	if len(p) >= t.max {
+		t.buf = append(t.buf[:0], p[len(p)-t.max:]...)
+		return
+	}
+	if over := len(t.buf) + len(p) - t.max; over > 0 {
+		t.buf = append(t.buf[:0], t.buf[over:]...)
+	}
+	t.buf = append(t.buf, p...)
+}
+
+// dumpOutput печатает в STDERR последние max байт output вместе с шаблоном,
+// которого ждал неудавшийся шаг, чтобы было видно, что прислал сервер.
+func dumpOutput(output []byte, max int, pattern string) {
+	if len(output) > max {
+		output = output[len(output)-max:]
+	}
+	fmt.Fprintf(os.Stderr, "--- last %d bytes received while waiting for %q ---\n", len(output), pattern)
+	os.Stderr.Write(output)
+	if len(output) > 0 && output[len(output)-1] != '\n' {
+		fmt.Fprintln(os.Stderr)
+	}
+	fmt.Fprintln(os.Stderr, "--- end of output ---")
+}
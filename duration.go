@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// durationValue — значение флага длительности. Принимает строки в формате
+// time.ParseDuration (10s, 500ms, 2m), а число без единиц для совместимости
+// с прежними целочисленными флагами трактует в единицах unit.
+type durationValue struct {
+	d    *time.Duration
+	unit time.Duration
+}
+
+func newDurationValue(p *time.Duration, value, unit time.Duration) *durationValue {
+	*p = value
+	return &durationValue{d: p, unit: unit}
+}
+
+func (v *durationValue) String() string {
+	if v == nil || v.d == nil {
+		return "0s"
+	}
+	return v.d.String()
+}
+
+func (v *durationValue) Set(s string) error {
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		*v.d = time.Duration(n) * v.unit
+		return nil
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("invalid duration %q", s)
+	}
+	*v.d = d
+	return nil
+}
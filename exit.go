@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// parseExitSend разбирает значение --exit-send. Поддерживаются экранирования
+// строк Go (\n, \r, \xff и т.п.), поэтому можно задать как текст вроде
+// "exit\n", так и команды Telnet вроде "\xff\xf4". Кавычки в значении —
+// обычные символы, экранировать их не нужно.
+func parseExitSend(s string) ([]byte, error) {
+	var quoted strings.Builder
+	quoted.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			// Экранирование переносится как есть вместе со следующим символом.
+			quoted.WriteByte('\\')
+			if i+1 < len(s) {
+				i++
+				quoted.WriteByte(s[i])
+			}
+		case '"':
+			quoted.WriteString(`\"`)
+		case '\n':
+			quoted.WriteString(`\n`)
+		default:
+			quoted.WriteByte(s[i])
+		}
+	}
+	quoted.WriteByte('"')
+
+	unquoted, err := strconv.Unquote(quoted.String())
+	if err != nil {
+		return nil, fmt.Errorf("invalid exit sequence %q: %w", s, err)
+	}
+	return []byte(unquoted), nil
+}
+
+// sendExit отправляет серверу прощальную последовательность, если она задана,
+// и даёт ему --exit-wait на её обработку. Всё это время ответ сервера
+// продолжает выводиться. Байты уходят как есть, без экранирования IAC.
+func sendExit(conn net.Conn, cfg *Config) {
+	if len(cfg.ExitSend) == 0 {
+		return
+	}
+
+	if _, err := conn.Write(cfg.ExitSend); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: failed to send exit sequence: %v\n", err)
+		return
+	}
+	time.Sleep(cfg.ExitWait)
+}
+
+// closeWrite закрывает соединение на запись, оставляя его открытым на
+// чтение, чтобы сервер получил EOF и мог дослать остаток вывода.
+func closeWrite(conn net.Conn) error {
+	for {
+		switch c := conn.(type) {
+		case interface{ CloseWrite() error }:
+			return c.CloseWrite()
+		case *writeTimeoutConn:
+			conn = c.Conn
+		case *pcapConn:
+			conn = c.Conn
+		default:
+			return fmt.Errorf("connection does not support half-close")
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestParseExitSend(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []byte
+	}{
+		{`exit\n`, []byte("exit\n")},
+		{`\r\n`, []byte("\r\n")},
+		{`\xff\xf4`, []byte{0xff, 0xf4}},
+		{`say "bye"\r\n`, []byte("say \"bye\"\r\n")},
+		{`say \"bye\"`, []byte(`say "bye"`)},
+		{`"`, []byte(`"`)},
+		{`a\\b`, []byte(`a\b`)},
+		{"line\nnext", []byte("line\nnext")},
+		{``, []byte{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := parseExitSend(tt.in)
+			if err != nil {
+				t.Fatalf("parseExitSend(%q): %v", tt.in, err)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("parseExitSend(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseExitSendInvalid(t *testing.T) {
+	for _, in := range []string{`\xzz`, `\q`, `trailing\`} {
+		if _, err := parseExitSend(in); err == nil {
+			t.Errorf("parseExitSend(%q) succeeded, want an error", in)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"regexp"
+	"time"
+)
+
+// reasonFetchDone — причина завершения сеанса в режиме --fetch.
+const reasonFetchDone = "fetch done"
+
+// fetchReader синхронно читает вывод сервера в режиме --fetch.
+type fetchReader struct {
+	conn    net.Conn
+	timeout time.Duration
+	pattern string
+	prompt  *regexp.Regexp
+	more    *regexp.Regexp // nil, если --auto-more выключен
+	moreKey byte
+	parser  *telnetParser // nil в режиме --raw
+	dump    int           // сколько байт вывода печатать при ошибке, 0 — не печатать
+	buf     []byte
+}
+
+// readUntilPrompt читает вывод, пока он не закончится приглашением, и
+// возвращает его вместе с приглашением. На приглашения постраничного
+// вывода (если включён --auto-more) отвечает --more-key и вырезает их
+// из результата. Если сервер молчит
+// дольше timeout, возвращается ошибка ожидания приглашения. При ошибке
+// ожидания полученный вывод печатается в STDERR, если задан dump.
+func (r *fetchReader) readUntilPrompt() ([]byte, error) {
+	var out []byte
+	for {
+		if err := r.conn.SetReadDeadline(time.Now().Add(r.timeout)); err != nil {
+			return nil, fmt.Errorf("failed to set read deadline: %w", err)
+		}
+
+		n, err := r.conn.Read(r.buf)
+		if n > 0 {
+			data := r.buf[:n]
+			if r.parser != nil {
+				var reply []byte
+				data, reply = r.parser.parse(data)
+				if len(reply) > 0 {
+					if _, err := r.conn.Write(reply); err != nil {
+						return nil, fmt.Errorf("failed to answer negotiation: %w", err)
+					}
+				}
+			}
+			out = append(out, data...)
+
+			if i := r.matchMore(out); i >= 0 {
+				out = out[:i]
+				if _, err := r.conn.Write([]byte{r.moreKey}); err != nil {
+					return nil, fmt.Errorf("failed to page output: %w", err)
+				}
+				continue
+			}
+			if matchEnd(r.prompt, out) >= 0 {
+				return out, nil
+			}
+		}
+
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			r.dumpOutput(out)
+			return nil, promptTimeout(r.timeout, r.pattern)
+		}
+		if err == io.EOF {
+			r.dumpOutput(out)
+			return nil, fmt.Errorf("server closed the connection before the prompt appeared")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read from server: %w", err)
+		}
+	}
+}
+
+// dumpOutput печатает хвост вывода неудавшегося шага, если включён --dump-on-error.
+func (r *fetchReader) dumpOutput(out []byte) {
+	if r.dump > 0 {
+		dumpOutput(out, r.dump, r.pattern)
+	}
+}
+
+// matchMore возвращает начало приглашения постраничного вывода в конце out или -1.
+func (r *fetchReader) matchMore(out []byte) int {
+	if r.more == nil {
+		return -1
+	}
+	return matchEnd(r.more, out)
+}
+
+// sendLine отправляет команду, завершая её CR LF.
+func (r *fetchReader) sendLine(command string) error {
+	line := []byte(command + "\r\n")
+	if r.parser != nil {
+		line = escapeIAC(line)
+	}
+	if _, err := r.conn.Write(line); err != nil {
+		return fmt.Errorf("failed to send command %q: %w", command, err)
+	}
+	return nil
+}
+
+// fetch дожидается приглашения, выполняет строки --command, затем
+// отправляет команду --fetch и сохраняет её очищенный вывод в --fetch-to.
+func fetch(conn net.Conn, cfg *Config) (string, error) {
+	prompt, err := compileAnchored(cfg.Prompt)
+	if err != nil {
+		return "", fmt.Errorf("invalid prompt pattern %q: %w", cfg.Prompt, err)
+	}
+
+	r := &fetchReader{
+		conn:    conn,
+		timeout: cfg.PromptTimeout,
+		pattern: cfg.Prompt,
+		prompt:  prompt,
+		moreKey: cfg.MoreKey,
+		buf:     make([]byte, 1024),
+	}
+	if cfg.AutoMore {
+		more, err := compileAnchored(cfg.MorePrompt)
+		if err != nil {
+			return "", fmt.Errorf("invalid more prompt pattern %q: %w", cfg.MorePrompt, err)
+		}
+		r.more = more
+	}
+	if !cfg.Raw {
+		r.parser = &telnetParser{keepNulls: cfg.KeepNulls}
+	}
+	if cfg.DumpOnError {
+		r.dump = cfg.DumpBytes
+	}
+
+	if _, err := r.readUntilPrompt(); err != nil {
+		return "", err
+	}
+	for _, command := range cfg.Commands {
+		if err := r.sendLine(command); err != nil {
+			return "", err
+		}
+		if _, err := r.readUntilPrompt(); err != nil {
+			return "", err
+		}
+	}
+
+	if err := r.sendLine(cfg.Fetch); err != nil {
+		return "", err
+	}
+	output, err := r.readUntilPrompt()
+	if err != nil {
+		return "", err
+	}
+
+	result := cleanCapture(output, cfg.Fetch)
+	if err := os.WriteFile(cfg.FetchTo, result, 0o644); err != nil {
+		return "", fmt.Errorf("failed to write %s: %w", cfg.FetchTo, err)
+	}
+	fmt.Fprintf(os.Stderr, "fetched %d bytes to %s\n", len(result), cfg.FetchTo)
+
+	sendExit(conn, cfg)
+	return reasonFetchDone, nil
+}
+
+// moreResidue — остатки стёртого приглашения постраничного вывода: возврат
+// каретки, пробелы поверх приглашения и снова возврат каретки.
+var moreResidue = regexp.MustCompile(`\r +\r`)
+
+// cleanCapture приводит захваченный вывод к содержимому файла: применяет
+// забои, убирает следы стёртых приглашений --More--, эхо самой команды
+// в первой строке и завершающее приглашение после последнего перевода строки.
+func cleanCapture(output []byte, command string) []byte {
+	output = eraseBackspaces(output)
+	output = moreResidue.ReplaceAll(output, nil)
+
+	if i := bytes.LastIndexByte(output, '\n'); i >= 0 {
+		output = output[:i+1]
+	} else {
+		output = nil
+	}
+
+	if line, rest, ok := bytes.Cut(output, []byte("\n")); ok {
+		if string(bytes.TrimSpace(line)) == command {
+			output = rest
+		}
+	}
+	return output
+}
+
+// eraseBackspaces применяет символы BS к предыдущим байтам в пределах строки.
+func eraseBackspaces(p []byte) []byte {
+	out := make([]byte, 0, len(p))
+	for _, b := range p {
+		if b == '\b' {
+			if len(out) > 0 && out[len(out)-1] != '\n' {
+				out = out[:len(out)-1]
+			}
+			continue
+		}
+		out = append(out, b)
+	}
+	return out
+}
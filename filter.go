@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"time"
+)
+
+// filterGrace — сколько ждать завершения выходного фильтра после закрытия
+// его стандартного ввода, прежде чем завершить процесс принудительно.
+const filterGrace = 2 * time.Second
+
+// filter — внешняя команда, встроенная в поток сеанса как звено конвейера.
+type filter struct {
+	command string
+	cmd     *exec.Cmd
+	pipe    *os.File // наш конец канала: запись для выходного фильтра, чтение для входного
+	done    chan struct{}
+}
+
+// shellCommand готовит запуск команды через системную оболочку.
+func shellCommand(command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.Command("cmd", "/C", command)
+	}
+	return exec.Command("/bin/sh", "-c", command)
+}
+
+// startOutputFilter запускает команду, которая получает данные от сервера
+// на стандартный ввод и пишет результат в out.
+func startOutputFilter(command string, out io.Writer) (*filter, error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create pipe for %q: %w", command, err)
+	}
+
+	cmd := shellCommand(command)
+	cmd.Stdin = r
+	cmd.Stdout = out
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		r.Close()
+		w.Close()
+		return nil, fmt.Errorf("failed to start %q: %w", command, err)
+	}
+	r.Close()
+
+	return newFilter(command, cmd, w), nil
+}
+
+// startInputFilter запускает команду, которая читает in и отдаёт
+// преобразованные данные для отправки на сервер.
+func startInputFilter(command string, in io.Reader) (*filter, error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create pipe for %q: %w", command, err)
+	}
+
+	cmd := shellCommand(command)
+	cmd.Stdin = in
+	cmd.Stdout = w
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		r.Close()
+		w.Close()
+		return nil, fmt.Errorf("failed to start %q: %w", command, err)
+	}
+	w.Close()
+
+	return newFilter(command, cmd, r), nil
+}
+
+func newFilter(command string, cmd *exec.Cmd, pipe *os.File) *filter {
+	f := &filter{
+		command: command,
+		cmd:     cmd,
+		pipe:    pipe,
+		done:    make(chan struct{}),
+	}
+	go func() {
+		cmd.Wait()
+		close(f.done)
+	}()
+	return f
+}
+
+func (f *filter) Write(p []byte) (int, error) {
+	return f.pipe.Write(p)
+}
+
+func (f *filter) Read(p []byte) (int, error) {
+	return f.pipe.Read(p)
+}
+
+// stop закрывает наш конец канала и ждёт завершения команды не дольше grace,
+// после чего завершает её принудительно. Код завершения выводится в STDERR.
+func (f *filter) stop(grace time.Duration) {
+	f.pipe.Close()
+
+	select {
+	case <-f.done:
+	case <-time.After(grace):
+		f.cmd.Process.Kill()
+		<-f.done
+	}
+
+	fmt.Fprintf(os.Stderr, "exec %q: %s\n", f.command, f.cmd.ProcessState)
+}
+
+// wait закрывает наш конец канала и ждёт, пока команда завершится сама.
+func (f *filter) wait() {
+	f.pipe.Close()
+	<-f.done
+}
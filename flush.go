@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"sync"
+	"time"
+)
+
+// flushBufferSize — размер буфера вывода для --flush-interval. Заполненный
+// буфер сбрасывается сразу, не дожидаясь таймера.
+const flushBufferSize = 64 * 1024
+
+// flushWriter накапливает вывод и сбрасывает его по таймеру или при
+// заполнении буфера, чтобы поток данных от сервера не превращался
+// в системный вызов на каждый прочитанный фрагмент. Ошибка фоновой
+// записи возвращается следующим вызовом Write.
+type flushWriter struct {
+	mu   sync.Mutex
+	w    *bufio.Writer
+	err  error
+	stop chan struct{}
+	done chan struct{}
+}
+
+func newFlushWriter(out io.Writer, interval time.Duration) *flushWriter {
+	f := &flushWriter{
+		w:    bufio.NewWriterSize(out, flushBufferSize),
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	go f.loop(interval)
+	return f
+}
+
+func (f *flushWriter) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.err != nil {
+		return 0, f.err
+	}
+	return f.w.Write(p)
+}
+
+// loop сбрасывает буфер каждые interval до вызова close.
+func (f *flushWriter) loop(interval time.Duration) {
+	defer close(f.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-f.stop:
+			return
+		case <-ticker.C:
+			f.flush()
+		}
+	}
+}
+
+func (f *flushWriter) flush() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.err == nil {
+		f.err = f.w.Flush()
+	}
+	return f.err
+}
+
+// close останавливает таймер и сбрасывает остаток буфера.
+func (f *flushWriter) close() error {
+	close(f.stop)
+	<-f.done
+	return f.flush()
+}
@@ -0,0 +1,18 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// BenchmarkSessionOutput измеряет вывод telnet-сеанса, где каждый
+// прочитанный фрагмент сразу пишется в STDOUT.
+func BenchmarkSessionOutput(b *testing.B) {
+	benchmarkSession(b, &Config{SendQueue: 64, SendQueuePolicy: queueBlock})
+}
+
+// BenchmarkSessionOutputFlushInterval измеряет тот же вывод с
+// --flush-interval 50ms, когда он пишется пачками до 64 КиБ.
+func BenchmarkSessionOutputFlushInterval(b *testing.B) {
+	benchmarkSession(b, &Config{SendQueue: 64, SendQueuePolicy: queueBlock, FlushInterval: 50 * time.Millisecond})
+}
@@ -1,3 +1,9 @@
 module gotelnet
 
-go 1.25
+go 1.25.0
+
+require (
+	github.com/chzyer/readline v1.5.1
+	go.bug.st/serial v1.8.0
+	golang.org/x/sys v0.43.0
+)
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"time"
+)
+
+// heartbeat каждые interval отправляет серверу IAC NOP и записывает
+// в STDERR отметку времени с результатом записи, чтобы по журналу можно
+// было восстановить, когда соединение ещё было живо. Если check включён,
+// неудачная запись завершает сеанс с ошибкой через fail.
+func heartbeat(conn net.Conn, interval time.Duration, check bool, stop <-chan struct{}, fail func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case t := <-ticker.C:
+			stamp := t.Format(time.RFC3339Nano)
+			if _, err := conn.Write([]byte{cmdIAC, cmdNOP}); err != nil {
+				fmt.Fprintf(os.Stderr, "%s heartbeat: IAC NOP failed: %v\n", stamp, err)
+				if check {
+					fail(fmt.Errorf("heartbeat write failed: %w", err))
+					return
+				}
+				continue
+			}
+			fmt.Fprintf(os.Stderr, "%s heartbeat: IAC NOP sent\n", stamp)
+		}
+	}
+}
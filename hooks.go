@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+)
+
+// runHook запускает команду-хук в фоне, не дожидаясь её завершения.
+// Сведения о сеансе передаются через переменные окружения GOTELNET_*,
+// весь вывод команды направляется в STDERR.
+func runHook(command string, env []string) {
+	cmd := shellCommand(command)
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: hook %q failed to start: %v\n", command, err)
+		return
+	}
+	go cmd.Wait()
+}
+
+// sessionTarget возвращает целевой хост и порт сеанса: в режиме --listen —
+// адрес и порт прослушивания, в режиме --serial — имя устройства и 0.
+func sessionTarget(cfg *Config) (string, int) {
+	switch {
+	case cfg.Serial != "":
+		return cfg.Serial, 0
+	case cfg.Listen != 0:
+		return cfg.ListenAddr, cfg.Listen
+	}
+	return cfg.Host, cfg.Port
+}
+
+// hookEnv описывает сеанс для хуков: целевой хост и порт (см. sessionTarget)
+// и адреса обеих сторон соединения.
+func hookEnv(cfg *Config, conn net.Conn) []string {
+	host, port := sessionTarget(cfg)
+	return []string{
+		"GOTELNET_HOST=" + host,
+		"GOTELNET_PORT=" + strconv.Itoa(port),
+		"GOTELNET_REMOTE_ADDR=" + conn.RemoteAddr().String(),
+		"GOTELNET_LOCAL_ADDR=" + conn.LocalAddr().String(),
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// byteMap — таблица замены байт ввода, заполняется повторяемым флагом
+// --map в формате <from>=<to> (оба значения в шестнадцатеричном виде).
+type byteMap map[byte]byte
+
+func (m byteMap) String() string {
+	pairs := make([]string, 0, len(m))
+	for from, to := range m {
+		pairs = append(pairs, fmt.Sprintf("%02x=%02x", from, to))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (m byteMap) Set(value string) error {
+	fromStr, toStr, ok := strings.Cut(value, "=")
+	if !ok {
+		return fmt.Errorf("expected <from>=<to>, got %q", value)
+	}
+
+	from, err := parseHexByte(fromStr)
+	if err != nil {
+		return err
+	}
+	to, err := parseHexByte(toStr)
+	if err != nil {
+		return err
+	}
+
+	m[from] = to
+	return nil
+}
+
+// apply заменяет байты p на месте согласно таблице.
+func (m byteMap) apply(p []byte) {
+	for i, b := range p {
+		if to, ok := m[b]; ok {
+			p[i] = to
+		}
+	}
+}
+
+// parseHexByte разбирает один байт в шестнадцатеричной записи, допуская префикс 0x.
+func parseHexByte(s string) (byte, error) {
+	s = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(s)), "0x")
+	v, err := strconv.ParseUint(s, 16, 8)
+	if err != nil {
+		return 0, fmt.Errorf("invalid hex byte %q", s)
+	}
+	return byte(v), nil
+}
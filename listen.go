@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+)
+
+// listen открывает порт на указанном интерфейсе и принимает ровно одно
+// входящее TCP-соединение. После этого слушающий сокет закрывается.
+func listen(cfg *Config) (net.Conn, error) {
+	address := net.JoinHostPort(cfg.ListenAddr, strconv.Itoa(cfg.Listen))
+	ln, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", address, err)
+	}
+	defer ln.Close()
+
+	if cfg.ListenTimeout > 0 {
+		deadline := time.Now().Add(cfg.ListenTimeout)
+		if err := ln.(*net.TCPListener).SetDeadline(deadline); err != nil {
+			return nil, fmt.Errorf("failed to set accept deadline: %w", err)
+		}
+	}
+
+	conn, err := ln.Accept()
+	if err != nil {
+		return nil, fmt.Errorf("failed to accept connection on %s: %w", address, err)
+	}
+
+	return conn, nil
+}
@@ -6,111 +6,989 @@ import (
 	"io"
 	"net"
 	"os"
+	"os/signal"
 	"strconv"
 	"sync"
+	"syscall"
 	"time"
+
+	"go.bug.st/serial"
 )
 
 type Config struct {
 	Host    string
 	Port    int
-	Timeout int
+	Timeout time.Duration
+
+	ConnectAttempts int
+	ConnectBackoff  time.Duration
+
+	Exec      string
+	ExecInput string
+
+	Listen        int
+	ListenAddr    string
+	ListenTimeout time.Duration
+
+	SendQueue       int
+	SendQueuePolicy string
+
+	Heartbeat      time.Duration
+	HeartbeatCheck bool
+
+	Commands          stringList
+	CommandDelay      time.Duration
+	ExitAfterCommands bool
+	WaitPrompt        bool
+	Prompt            string
+	PromptTimeout     time.Duration
+
+	InputMap byteMap
+
+	OnConnect    string
+	OnDisconnect string
+
+	Pager             bool
+	KeepOnStdoutError bool
+
+	BannerOnly  bool
+	BannerQuiet time.Duration
+	BannerMax   int
+
+	Readline    bool
+	HistoryFile string
+
+	Raw bool
+
+	Pcap string
+
+	ExitSend []byte
+	ExitWait time.Duration
+
+	Fetch   string
+	FetchTo string
+
+	AutoMore   bool
+	MorePrompt string
+	MoreKey    byte
+
+	Serial   string
+	Baud     int
+	DataBits int
+	Parity   serial.Parity
+	StopBits serial.StopBits
+
+	Probe        bool
+	ProbeOptions []byte
+	ProbeTimeout time.Duration
+
+	WriteTimeout time.Duration
+
+	WaitForClose bool
+	CloseWrite   bool
+
+	NoBell    bool
+	RemapBell bool
+	BellTo    byte
+
+	DumpOnError bool
+	DumpBytes   int
+
+	Netns string
+
+	FlushInterval time.Duration
+
+	TargetFromStdin bool
+
+	KeepNulls bool
+
+	ResumeState string
+
+	Ping         bool
+	PingCount    int
+	PingSend     []byte
+	PingInterval time.Duration
+	PingTimeout  time.Duration
+
+	Play     string
+	Speed    float64
+	PlayFrom time.Duration
+
+	SquelchRepeats bool
+	SquelchTimeout time.Duration
+
+	BreakOnStart  bool
+	BreakInterval time.Duration
+
+	DetectTelnet bool
 }
 
-func parseArgs() (*Config, error) {
-	var timeout int
-	flag.IntVar(&timeout, "timeout", 10, "connection timeout in seconds")
-	flag.Usage = func() {
-		fmt.Fprintf(os.Stderr, "Usage: %s [options] <host> <port>\n", os.Args[0])
-		flag.PrintDefaults()
+// parseArgs разбирает аргументы командной строки. Первым аргументом может
+// идти подкоманда (connect, serve, serial или probe) со своим набором флагов;
+// без неё аргументы разбираются как у connect.
+func parseArgs(arguments []string) (*Config, error) {
+	sub, arguments, explicit := splitSubcommand(arguments)
+	fs := flag.NewFlagSet(sub, flag.ExitOnError)
+
+	var timeout time.Duration
+	var connectAttempts int
+	var connectBackoff time.Duration
+	var execCmd, execInput string
+	var listen int
+	var listenTimeout time.Duration
+	var listenAddr string
+	var sendQueue int
+	var sendQueuePolicy string
+	var heartbeatInterval time.Duration
+	var heartbeatCheck bool
+	var commands stringList
+	var commandDelay time.Duration
+	var exitAfterCommands bool
+	var prompt string
+	var waitPrompt bool
+	var promptTimeout time.Duration
+	inputMap := byteMap{}
+	var pager, keepOnStdoutError bool
+	var onConnect, onDisconnect string
+	var bannerOnly bool
+	var bannerQuiet time.Duration
+	var bannerMax int
+	var readlineMode bool
+	var historyFile string
+	var raw bool
+	var pcapFile string
+	var exitSend string
+	var exitWait time.Duration
+	var fetchCommand, fetchTo string
+	var autoMore bool
+	var morePrompt, moreKey string
+	var serialPort, parity, stopBits string
+	var baud, dataBits int
+	var probe bool
+	var probeList string
+	var probeTimeout time.Duration
+	var writeTimeout time.Duration
+	var waitForClose, closeWriteFlag bool
+	var noBell bool
+	var bellTo string
+	var dumpOnError bool
+	var dumpBytes int
+	var netns string
+	var flushInterval time.Duration
+	var targetFromStdin bool
+	var keepNulls bool
+	var resumeStateFile string
+	var ping bool
+	var pingCount int
+	var pingSend string
+	var pingInterval, pingTimeout time.Duration
+	var playFile string
+	var speed float64
+	var playFrom time.Duration
+	var squelchRepeats bool
+	var squelchTimeout time.Duration
+	var breakOnStart bool
+	var breakInterval time.Duration
+	var detectTelnet bool
+	// Флаги зарегистрированы группами по назначению.
+	timeoutFlags := func(fs *flag.FlagSet) {
+		fs.Var(newDurationValue(&timeout, 10*time.Second, time.Second), "timeout", "connection timeout, e.g. 10s or 500ms (a bare number means seconds)")
+	}
+	dialFlags := func(fs *flag.FlagSet) {
+		fs.IntVar(&connectAttempts, "connect-attempts", 1, "number of connection attempts on refused or timed out connects")
+		fs.Var(newDurationValue(&connectBackoff, time.Second, time.Second), "connect-backoff", "initial pause between connection attempts, doubled each time with random jitter (a bare number means seconds)")
+		fs.StringVar(&netns, "netns", "", "connect from the network namespace at this path, e.g. /var/run/netns/blue (Linux only)")
+		fs.BoolVar(&targetFromStdin, "target-from-stdin", false, `read the server address from the first line of stdin ("host port" or "host:port"), then use the rest as input`)
+	}
+	listenFlags := func(fs *flag.FlagSet) {
+		fs.StringVar(&listenAddr, "listen-addr", "", "local address to bind in listen mode (default all interfaces)")
+		fs.Var(newDurationValue(&listenTimeout, 0, time.Second), "listen-timeout", "how long to wait for the inbound connection, 0 waits forever (a bare number means seconds)")
+	}
+	serialFlags := func(fs *flag.FlagSet) {
+		fs.IntVar(&baud, "baud", 9600, "serial baud rate")
+		fs.IntVar(&dataBits, "databits", 8, "serial data bits: 5, 6, 7 or 8")
+		fs.StringVar(&parity, "parity", "none", "serial parity: none, odd, even, mark or space")
+		fs.StringVar(&stopBits, "stopbits", "1", "serial stop bits: 1, 1.5 or 2")
+	}
+	telnetFlags := func(fs *flag.FlagSet) {
+		fs.BoolVar(&raw, "raw", false, "treat the connection as a plain byte stream: send input unchanged, without IAC escaping, and print server output without stripping telnet commands")
+		fs.BoolVar(&keepNulls, "keep-nulls", false, "keep the NUL that follows CR in server output instead of dropping it as telnet requires")
+		fs.BoolVar(&detectTelnet, "detect-telnet", false, "with --raw, warn on stderr if the server starts telnet negotiation")
+		fs.Var(newDurationValue(&heartbeatInterval, 0, time.Second), "heartbeat", "send IAC NOP at this interval and log each one to stderr, 0 disables (a bare number means seconds)")
+		fs.BoolVar(&heartbeatCheck, "heartbeat-check", false, "end the session with an error if a heartbeat cannot be written")
+		fs.StringVar(&pcapFile, "pcap", "", "write the session to this pcap file with synthesized TCP/IP headers")
+		fs.Var(newDurationValue(&writeTimeout, 0, time.Second), "write-timeout", "fail the session if a write to the server blocks longer than this, 0 disables (a bare number means seconds)")
+		fs.BoolVar(&closeWriteFlag, "close-write", false, "with --wait-for-close, half-close the connection once input ends so the server sees EOF")
+	}
+	sessionFlags := func(fs *flag.FlagSet) {
+		fs.StringVar(&execCmd, "exec", "", "pipe data received from the server through this shell command")
+		fs.StringVar(&execInput, "exec-input", "", "pipe input through this shell command before sending it to the server")
+		fs.IntVar(&sendQueue, "send-queue", 64, "number of input chunks buffered while the server is not reading")
+		fs.StringVar(&sendQueuePolicy, "send-queue-policy", queueBlock, "what to do when the send queue is full: block or drop")
+		fs.Var(&commands, "command", "send this line (followed by CR LF) before forwarding stdin (repeatable, sent in order)")
+		fs.Var(newDurationValue(&commandDelay, 500*time.Millisecond, time.Second), "command-delay", "pause after each --command (a bare number means seconds)")
+		fs.BoolVar(&exitAfterCommands, "exit-after-commands", false, "end the session after the last --command instead of forwarding stdin")
+		fs.BoolVar(&waitPrompt, "wait-prompt", false, "wait for the server prompt before each --command and before forwarding stdin")
+		fs.StringVar(&prompt, "prompt", `[>#$%]\s*$`, "regular expression matching the server prompt at the end of its output")
+		fs.Var(newDurationValue(&promptTimeout, 10*time.Second, time.Second), "prompt-timeout", "how long to wait for the prompt with --wait-prompt (a bare number means seconds)")
+		fs.Var(inputMap, "map", "rewrite an input byte before sending, as hex <from>=<to> (repeatable, e.g. 7f=08)")
+		fs.BoolVar(&pager, "pager", false, "show server output through $PAGER (less by default) when stdout is a terminal; input is still forwarded unless stdin is the terminal the pager reads, and quitting it ends the session")
+		fs.BoolVar(&keepOnStdoutError, "keep-on-stdout-error", false, "keep the session running if writing to stdout fails, discarding output")
+		fs.BoolVar(&readlineMode, "readline", false, "edit input lines locally with history before sending them")
+		fs.StringVar(&historyFile, "history-file", "", "file to load and save --readline history")
+		fs.StringVar(&exitSend, "exit-send", "", `bytes to send before closing when input ends, with Go escapes (e.g. "exit\n" or "\xff\xf4")`)
+		fs.Var(newDurationValue(&exitWait, 500*time.Millisecond, time.Millisecond), "exit-wait", "how long to keep reading after --exit-send before closing (a bare number means milliseconds)")
+		fs.BoolVar(&autoMore, "auto-more", true, "answer pager prompts automatically during --command and --fetch and strip them from output")
+		fs.StringVar(&morePrompt, "more-prompt", defaultMorePrompt, "regular expression matching a pager prompt at the end of the output")
+		fs.StringVar(&moreKey, "more-key", " ", "key sent to continue paged output: a single character or a hex byte such as 0x0d")
+		fs.BoolVar(&waitForClose, "wait-for-close", false, "when input ends, keep printing server output until the server closes the connection")
+		fs.BoolVar(&dumpOnError, "dump-on-error", true, "print the last server output to stderr when waiting for a prompt fails")
+		fs.IntVar(&dumpBytes, "dump-bytes", 1024, "how many bytes of server output --dump-on-error prints")
+		fs.StringVar(&resumeStateFile, "resume-state", "", "file recording how many bytes the device has sent; on the next session to the same target that much output is suppressed (best-effort)")
+		fs.BoolVar(&breakOnStart, "break-on-start", false, "send a BREAK (IAC BRK, or a line break with --serial) as soon as the session starts")
+		fs.Var(newDurationValue(&breakInterval, 0, time.Second), "break-interval", "send a BREAK at this interval and log each one to stderr, 0 disables (a bare number means seconds)")
+	}
+	outputFlags := func(fs *flag.FlagSet) {
+		fs.BoolVar(&noBell, "no-bell", false, "strip BEL (0x07) characters from server output")
+		fs.StringVar(&bellTo, "bell-to", "", "replace BEL (0x07) in server output with this hex byte, e.g. 0x2a")
+		fs.Var(newDurationValue(&flushInterval, 0, time.Second), "flush-interval", "buffer server output and write it out at this interval or when the buffer fills, e.g. 50ms, 0 writes at once (a bare number means seconds)")
+		fs.BoolVar(&squelchRepeats, "squelch-repeats", false, `collapse consecutive identical output lines into one line and a "(repeated N times)" counter`)
+		fs.Var(newDurationValue(&squelchTimeout, time.Second, time.Second), "squelch-timeout", "print the --squelch-repeats counter, and any held partial line, after this much quiet (a bare number means seconds)")
+	}
+	modeFlags := func(fs *flag.FlagSet) {
+		fs.BoolVar(&bannerOnly, "banner-only", false, "print what the server sends without sending anything, then disconnect")
+		fs.Var(newDurationValue(&bannerQuiet, time.Second, time.Millisecond), "banner-quiet", "silence that ends the banner with --banner-only (a bare number means milliseconds)")
+		fs.IntVar(&bannerMax, "banner-max", 4096, "maximum number of banner bytes to read with --banner-only")
+		fs.StringVar(&fetchCommand, "fetch", "", "run this command after the prompt (and any --command lines), save its output to --fetch-to and exit")
+		fs.StringVar(&fetchTo, "fetch-to", "", "local file for the output of --fetch")
+		fs.BoolVar(&ping, "ping-rtt", false, "measure the time until the server answers --ping-send, like ping, print the summary to stderr and exit")
+		fs.IntVar(&pingCount, "count", 5, "number of probes sent with --ping-rtt")
+		fs.StringVar(&pingSend, "ping-send", `\r\n`, `probe sent with --ping-rtt, with Go escapes (e.g. "\r\n"); without --raw, "\xff\xfd\x06" (IAC DO TIMING-MARK) is answered at the telnet level`)
+		fs.Var(newDurationValue(&pingInterval, time.Second, time.Second), "ping-interval", "pause before each --ping-rtt probe, during which server output is discarded (a bare number means seconds)")
+		fs.Var(newDurationValue(&pingTimeout, 2*time.Second, time.Second), "ping-timeout", "how long to wait for a reply to each --ping-rtt probe (a bare number means seconds)")
+	}
+	hookFlags := func(fs *flag.FlagSet) {
+		fs.StringVar(&onConnect, "on-connect", "", "run this shell command in the background once connected")
+		fs.StringVar(&onDisconnect, "on-disconnect", "", "run this shell command in the background when the session ends")
+	}
+	probeFlags := func(fs *flag.FlagSet) {
+		fs.StringVar(&probeList, "probe-list", defaultProbeOptions, "comma-separated telnet options (names or numbers) for --probe-options")
+		fs.Var(newDurationValue(&probeTimeout, 3*time.Second, time.Second), "probe-timeout", "how long to wait for replies with --probe-options (a bare number means seconds)")
+	}
+
+	// Выбор режима флагом — прежняя форма вызова, у подкоманд режим задаёт
+	// сама подкоманда.
+	modeSwitchFlags := func(fs *flag.FlagSet) {
+		fs.IntVar(&listen, "listen", 0, "accept one inbound connection on this port instead of dialing")
+		fs.StringVar(&serialPort, "serial", "", "bridge a local serial device (e.g. /dev/ttyUSB0) instead of connecting over TCP")
+		fs.BoolVar(&probe, "probe-options", false, "offer telnet options to the server, print which it accepts and exit")
+	}
+	playFlags := func(fs *flag.FlagSet) {
+		fs.StringVar(&playFile, "play", "", "replay this asciinema v2 recording to stdout with its original timing instead of connecting")
+		fs.Float64Var(&speed, "speed", 1, "playback speed multiplier for --play; 0 steps one frame per Enter")
+		fs.Var(newDurationValue(&playFrom, 0, time.Second), "play-from", "start --play timing at this offset into the recording, printing earlier output at once (a bare number means seconds)")
+	}
+
+	// Подкоманда регистрирует только нужные ей группы флагов. Без подкоманды
+	// доступны все флаги, как до появления подкоманд.
+	allFlags := []func(*flag.FlagSet){timeoutFlags, dialFlags, listenFlags, serialFlags, telnetFlags,
+		sessionFlags, outputFlags, modeFlags, hookFlags, probeFlags, modeSwitchFlags, playFlags}
+	subcommandFlags := map[string][]func(*flag.FlagSet){
+		subConnect: {timeoutFlags, dialFlags, telnetFlags, sessionFlags, outputFlags, modeFlags, hookFlags},
+		subServe:   {timeoutFlags, listenFlags, telnetFlags, sessionFlags, outputFlags, modeFlags, hookFlags},
+		subSerial:  {timeoutFlags, serialFlags, sessionFlags, outputFlags, modeFlags, hookFlags},
+		subProbe:   {timeoutFlags, dialFlags, probeFlags, hookFlags},
+	}
+
+	// Значения по умолчанию нужны и флагам, которых у подкоманды нет,
+	// поэтому сначала все группы регистрируются в отдельном наборе.
+	defaults := flag.NewFlagSet(sub, flag.ContinueOnError)
+	for _, register := range allFlags {
+		register(defaults)
+	}
+	registered := allFlags
+	if explicit {
+		registered = subcommandFlags[sub]
+	}
+	for _, register := range registered {
+		register(fs)
+	}
+
+	fs.Usage = func() {
+		printUsage(sub, explicit)
+		fs.PrintDefaults()
+	}
+	fs.Parse(arguments)
+
+	args := fs.Args()
+	switch sub {
+	case subServe:
+		if len(args) != 1 {
+			return nil, fmt.Errorf("expected exactly 1 positional argument: <port>")
+		}
+		port, err := parsePort(args[0])
+		if err != nil {
+			return nil, err
+		}
+		listen, args = port, nil
+	case subSerial:
+		if len(args) != 1 {
+			return nil, fmt.Errorf("expected exactly 1 positional argument: <device>")
+		}
+		serialPort, args = args[0], nil
+	case subProbe:
+		probe = true
+	}
+
+	cfg := &Config{
+		Timeout: timeout,
+
+		ConnectAttempts: connectAttempts,
+		ConnectBackoff:  connectBackoff,
+
+		Exec:          execCmd,
+		ExecInput:     execInput,
+		Listen:        listen,
+		ListenAddr:    listenAddr,
+		ListenTimeout: listenTimeout,
+
+		SendQueue:       sendQueue,
+		SendQueuePolicy: sendQueuePolicy,
+
+		Heartbeat:      heartbeatInterval,
+		HeartbeatCheck: heartbeatCheck,
+
+		Commands:          commands,
+		CommandDelay:      commandDelay,
+		ExitAfterCommands: exitAfterCommands,
+		WaitPrompt:        waitPrompt,
+		Prompt:            prompt,
+		PromptTimeout:     promptTimeout,
+
+		InputMap: inputMap,
+
+		OnConnect:    onConnect,
+		OnDisconnect: onDisconnect,
+
+		Pager:             pager,
+		KeepOnStdoutError: keepOnStdoutError,
+
+		BannerOnly:  bannerOnly,
+		BannerQuiet: bannerQuiet,
+		BannerMax:   bannerMax,
+
+		Readline:    readlineMode,
+		HistoryFile: historyFile,
+
+		Raw: raw,
+
+		Pcap: pcapFile,
+
+		ExitWait: exitWait,
+
+		Fetch:   fetchCommand,
+		FetchTo: fetchTo,
+
+		AutoMore:   autoMore,
+		MorePrompt: morePrompt,
+
+		Serial:   serialPort,
+		Baud:     baud,
+		DataBits: dataBits,
+
+		Probe:        probe,
+		ProbeTimeout: probeTimeout,
+
+		WriteTimeout: writeTimeout,
+
+		WaitForClose: waitForClose,
+		CloseWrite:   closeWriteFlag,
+
+		NoBell: noBell,
+
+		DumpOnError: dumpOnError,
+		DumpBytes:   dumpBytes,
+
+		Netns: netns,
+
+		FlushInterval: flushInterval,
+
+		TargetFromStdin: targetFromStdin,
+
+		KeepNulls: keepNulls,
+
+		ResumeState: resumeStateFile,
+
+		Ping:         ping,
+		PingCount:    pingCount,
+		PingInterval: pingInterval,
+		PingTimeout:  pingTimeout,
+
+		Play:     playFile,
+		Speed:    speed,
+		PlayFrom: playFrom,
+
+		SquelchRepeats: squelchRepeats,
+		SquelchTimeout: squelchTimeout,
+
+		BreakOnStart:  breakOnStart,
+		BreakInterval: breakInterval,
+
+		DetectTelnet: detectTelnet,
+	}
+
+	if writeTimeout < 0 {
+		return nil, fmt.Errorf("write timeout must not be negative")
+	}
+	if writeTimeout > 0 && serialPort != "" {
+		return nil, fmt.Errorf("--write-timeout is not supported with --serial")
+	}
+
+	if closeWriteFlag && !waitForClose {
+		return nil, fmt.Errorf("--close-write requires --wait-for-close")
+	}
+	if closeWriteFlag && serialPort != "" {
+		return nil, fmt.Errorf("--close-write is not supported with --serial")
+	}
+
+	if bellTo != "" {
+		if noBell {
+			return nil, fmt.Errorf("--no-bell cannot be combined with --bell-to")
+		}
+		b, err := parseHexByte(bellTo)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bell replacement: %w", err)
+		}
+		cfg.RemapBell = true
+		cfg.BellTo = b
+	}
+
+	if targetFromStdin && (listen != 0 || serialPort != "") {
+		return nil, fmt.Errorf("--target-from-stdin cannot be combined with --listen or --serial")
+	}
+
+	if netns != "" {
+		if !netnsSupported {
+			return nil, fmt.Errorf("--netns is only supported on Linux")
+		}
+		if listen != 0 || serialPort != "" {
+			return nil, fmt.Errorf("--netns cannot be combined with --listen or --serial")
+		}
+	}
+
+	if speed < 0 {
+		return nil, fmt.Errorf("playback speed must not be negative")
+	}
+	if playFrom < 0 {
+		return nil, fmt.Errorf("playback offset must not be negative")
+	}
+
+	if ping {
+		seq, err := parseExitSend(pingSend)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ping probe: %w", err)
+		}
+		if len(seq) == 0 {
+			return nil, fmt.Errorf("ping probe must not be empty")
+		}
+		cfg.PingSend = seq
+		if pingCount < 1 {
+			return nil, fmt.Errorf("ping count must be at least 1")
+		}
+		if pingInterval < 0 {
+			return nil, fmt.Errorf("ping interval must not be negative")
+		}
+		if pingTimeout <= 0 {
+			return nil, fmt.Errorf("ping timeout must be positive")
+		}
+		if bannerOnly || fetchCommand != "" || probe {
+			return nil, fmt.Errorf("--ping-rtt cannot be combined with --banner-only, --fetch or --probe-options")
+		}
+	}
+
+	if probe {
+		options, err := parseOptionList(probeList)
+		if err != nil {
+			return nil, err
+		}
+		cfg.ProbeOptions = options
+		if probeTimeout <= 0 {
+			return nil, fmt.Errorf("probe timeout must be positive")
+		}
+		if bannerOnly || fetchCommand != "" || raw || serialPort != "" {
+			return nil, fmt.Errorf("--probe-options cannot be combined with --banner-only, --fetch, --raw or --serial")
+		}
+	}
+
+	if len(moreKey) == 1 {
+		cfg.MoreKey = moreKey[0]
+	} else {
+		key, err := parseHexByte(moreKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid more key: %w", err)
+		}
+		cfg.MoreKey = key
+	}
+	if _, err := compileAnchored(morePrompt); err != nil {
+		return nil, fmt.Errorf("invalid more prompt pattern %q: %w", morePrompt, err)
+	}
+
+	if exitSend != "" {
+		seq, err := parseExitSend(exitSend)
+		if err != nil {
+			return nil, err
+		}
+		cfg.ExitSend = seq
+	}
+	if exitWait < 0 {
+		return nil, fmt.Errorf("exit wait must not be negative")
+	}
+
+	if sendQueue < 1 {
+		return nil, fmt.Errorf("send queue size must be at least 1")
+	}
+	if sendQueuePolicy != queueBlock && sendQueuePolicy != queueDrop {
+		return nil, fmt.Errorf("invalid send queue policy %q: expected %s or %s", sendQueuePolicy, queueBlock, queueDrop)
+	}
+	if commandDelay < 0 {
+		return nil, fmt.Errorf("command delay must not be negative")
+	}
+	if connectAttempts < 1 {
+		return nil, fmt.Errorf("connect attempts must be at least 1")
+	}
+	if connectBackoff < 0 {
+		return nil, fmt.Errorf("connect backoff must not be negative")
+	}
+	if timeout < 0 {
+		return nil, fmt.Errorf("timeout must not be negative")
+	}
+	if detectTelnet && (!raw || serialPort != "") {
+		return nil, fmt.Errorf("--detect-telnet requires --raw and cannot be used with --serial")
+	}
+	if breakInterval < 0 {
+		return nil, fmt.Errorf("break interval must not be negative")
+	}
+	if (breakOnStart || breakInterval > 0) && raw && serialPort == "" {
+		return nil, fmt.Errorf("--break-on-start and --break-interval cannot be combined with --raw: IAC BRK would reach the server as data")
+	}
+	if heartbeatInterval < 0 {
+		return nil, fmt.Errorf("heartbeat interval must not be negative")
+	}
+	// IAC NOP имеет смысл только в telnet-потоке: с --raw или по
+	// последовательной линии эти байты дошли бы до устройства как данные.
+	if heartbeatInterval > 0 && (raw || serialPort != "") {
+		return nil, fmt.Errorf("--heartbeat cannot be combined with --raw or --serial")
+	}
+	if (fetchCommand == "") != (fetchTo == "") {
+		return nil, fmt.Errorf("--fetch and --fetch-to must be used together")
+	}
+	if fetchCommand != "" && bannerOnly {
+		return nil, fmt.Errorf("--fetch cannot be combined with --banner-only")
+	}
+	if readlineMode && pager {
+		return nil, fmt.Errorf("--readline cannot be combined with --pager")
+	}
+	if execInput != "" && pager && pagerSharesStdin() {
+		return nil, fmt.Errorf("--exec-input cannot be combined with --pager when stdin is the terminal")
+	}
+	if bannerQuiet <= 0 {
+		return nil, fmt.Errorf("banner quiet period must be positive")
+	}
+	if bannerMax < 1 {
+		return nil, fmt.Errorf("banner byte limit must be at least 1")
+	}
+	if squelchTimeout <= 0 {
+		return nil, fmt.Errorf("squelch timeout must be positive")
+	}
+	if flushInterval < 0 {
+		return nil, fmt.Errorf("flush interval must not be negative")
+	}
+	if dumpBytes < 1 {
+		return nil, fmt.Errorf("dump byte count must be at least 1")
+	}
+	if promptTimeout <= 0 {
+		return nil, fmt.Errorf("prompt timeout must be positive")
+	}
+
+	if playFile != "" {
+		if len(args) != 0 || listen != 0 || serialPort != "" || targetFromStdin {
+			return nil, fmt.Errorf("--play takes no target: positional arguments, --listen, --serial and --target-from-stdin are not allowed")
+		}
+		if bannerOnly || fetchCommand != "" || probe || ping {
+			return nil, fmt.Errorf("--play cannot be combined with --banner-only, --fetch, --probe-options or --ping-rtt")
+		}
+		if speed == 0 && pager && pagerSharesStdin() {
+			return nil, fmt.Errorf("--speed 0 reads stdin and cannot be combined with --pager when stdin is the terminal")
+		}
+		return cfg, nil
+	}
+
+	if serialPort != "" {
+		if len(args) != 0 {
+			return nil, fmt.Errorf("positional arguments are not allowed with --serial")
+		}
+		if listen != 0 {
+			return nil, fmt.Errorf("--serial cannot be combined with --listen")
+		}
+		if baud < 1 {
+			return nil, fmt.Errorf("baud rate must be positive")
+		}
+		if dataBits < 5 || dataBits > 8 {
+			return nil, fmt.Errorf("data bits must be between 5 and 8")
+		}
+		var err error
+		if cfg.Parity, err = parseParity(parity); err != nil {
+			return nil, err
+		}
+		if cfg.StopBits, err = parseStopBits(stopBits); err != nil {
+			return nil, err
+		}
+		// На последовательной линии нет протокола Telnet.
+		cfg.Raw = true
+		return cfg, nil
+	}
+
+	if listen != 0 {
+		if len(args) != 0 {
+			return nil, fmt.Errorf("positional arguments are not allowed with --listen")
+		}
+		if listen < 1 || listen > 65535 {
+			return nil, fmt.Errorf("listen port must be between 1 and 65535")
+		}
+		if listenTimeout < 0 {
+			return nil, fmt.Errorf("listen timeout must not be negative")
+		}
+		return cfg, nil
+	}
+
+	if targetFromStdin {
+		if len(args) != 0 {
+			return nil, fmt.Errorf("positional arguments are not allowed with --target-from-stdin")
+		}
+		return cfg, nil
 	}
-	flag.Parse()
 
-	args := flag.Args()
 	if len(args) != 2 {
 		return nil, fmt.Errorf("expected exactly 2 positional arguments: <host> <port>")
 	}
 
-	host := args[0]
-	portStr := args[1]
+	port, err := parsePort(args[1])
+	if err != nil {
+		return nil, err
+	}
 
-	port, err := strconv.Atoi(portStr)
+	cfg.Host = args[0]
+	cfg.Port = port
+	return cfg, nil
+}
+
+// parsePort разбирает номер порта и проверяет, что он лежит в допустимом диапазоне.
+func parsePort(s string) (int, error) {
+	port, err := strconv.Atoi(s)
 	if err != nil {
-		return nil, fmt.Errorf("invalid port number: %w", err)
+		return 0, fmt.Errorf("invalid port number: %w", err)
 	}
 
 	if port < 1 || port > 65535 {
-		return nil, fmt.Errorf("port must be between 1 and 65535")
+		return 0, fmt.Errorf("port must be between 1 and 65535")
 	}
 
-	return &Config{
-		Host:    host,
-		Port:    port,
-		Timeout: timeout,
-	}, nil
+	return port, nil
 }
 
 // connect устанавливает TCP-соединение с указанным хостом и портом,
-// используя заданный таймаут.
+// используя заданный таймаут. При временных сбоях делает до
+// --connect-attempts попыток, сообщая о каждой неудачной в STDERR.
+// С --netns соединение устанавливается из указанного пространства имён.
 func connect(cfg *Config) (net.Conn, error) {
 	dialer := &net.Dialer{
-		Timeout: time.Duration(cfg.Timeout) * time.Second,
+		Timeout: cfg.Timeout,
 	}
 
-	address := fmt.Sprintf("%s:%d", cfg.Host, cfg.Port)
-	conn, err := dialer.Dial("tcp", address)
-	if err != nil {
-		return nil, fmt.Errorf("failed to connect to %s: %w", address, err)
+	address := net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port))
+	dial := func() (net.Conn, error) {
+		return dialer.Dial("tcp", address)
+	}
+	if cfg.Netns != "" {
+		// Имя разрешается заранее, в текущем пространстве имён: резолвер
+		// может обращаться к DNS из других потоков, и в каком пространстве
+		// они окажутся, заранее неизвестно. Адрес-литерал соединяется
+		// в том же потоке, что и dialInNetns.
+		addrs, err := net.LookupHost(cfg.Host)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to %s: %w", address, err)
+		}
+		target := net.JoinHostPort(addrs[0], strconv.Itoa(cfg.Port))
+		dial = func() (net.Conn, error) {
+			return dialInNetns(cfg.Netns, func() (net.Conn, error) {
+				return dialer.Dial("tcp", target)
+			})
+		}
 	}
 
-	return conn, nil
+	for attempt := 1; ; attempt++ {
+		conn, err := dial()
+		if err == nil {
+			return conn, nil
+		}
+		if attempt >= cfg.ConnectAttempts || !retryable(err) {
+			return nil, fmt.Errorf("failed to connect to %s: %w", address, err)
+		}
+
+		wait := backoff(cfg.ConnectBackoff, attempt)
+		fmt.Fprintf(os.Stderr, "attempt %d/%d to connect to %s failed: %v; retrying in %v\n",
+			attempt, cfg.ConnectAttempts, address, err, wait.Round(time.Millisecond))
+		time.Sleep(wait)
+	}
 }
 
+// Причины завершения сеанса, передаваемые хуку --on-disconnect.
+const (
+	reasonRemoteClosed = "remote closed"
+	reasonInputClosed  = "input closed"
+	reasonServerLogout = "server logout"
+)
+
 // startIO запускает двунаправленный обмен данными между STDIN/STDOUT и соединением.
-// Эта функция не возвращает управление до завершения сеанса.
-func startIO(conn net.Conn) {
+// Если заданы --exec или --exec-input, соответствующий поток проходит через
+// внешнюю команду, а с --pager вывод показывается в пейджере. С
+// --flush-interval вывод пишется пачками. Эта функция
+// не возвращает управление до завершения сеанса и сообщает его причину.
+func startIO(conn net.Conn, cfg *Config) (string, error) {
+	var in io.Reader = os.Stdin
+	var out io.Writer = os.Stdout
+
+	if cfg.Readline {
+		lr, err := newLineReader(cfg.HistoryFile)
+		if err != nil {
+			return "", err
+		}
+		defer lr.Close()
+		in = lr
+		out = lr.Stdout()
+	}
+	if cfg.ExecInput != "" {
+		f, err := startInputFilter(cfg.ExecInput, in)
+		if err != nil {
+			return "", err
+		}
+		defer f.stop(0)
+		in = f
+	}
 	done := make(chan struct{})
 	var once sync.Once
-	closeDone := func() {
+	var reason string
+	var sessionErr error
+	finish := func(why string, err error) {
 		once.Do(func() {
+			reason = why
+			sessionErr = err
 			close(done)
 		})
 	}
+	fail := func(err error) {
+		finish(err.Error(), err)
+	}
+
+	var prompt *promptDetector
+	if cfg.WaitPrompt {
+		p, err := newPromptDetector(cfg.Prompt)
+		if err != nil {
+			return "", err
+		}
+		if cfg.DumpOnError {
+			p.history = newOutputTail(cfg.DumpBytes)
+		}
+		prompt = p
+	}
+
+	// Приглашения постраничного вывода обрабатываются, только пока
+	// выполняются строки --command.
+	var more *moreResponder
+	if cfg.AutoMore && len(cfg.Commands) > 0 {
+		m, err := newMoreResponder(cfg.MorePrompt, cfg.MoreKey)
+		if err != nil {
+			return "", err
+		}
+		m.active.Store(true)
+		more = m
+	}
+
+	var negotiator *telnetParser
+	if !cfg.Raw {
+		negotiator = newSessionParser(func() { finish(reasonServerLogout, nil) })
+		negotiator.keepNulls = cfg.KeepNulls
+	}
+
+	var resume *resumeState
+	if cfg.ResumeState != "" {
+		host, port := sessionTarget(cfg)
+		r, err := loadResume(cfg.ResumeState, net.JoinHostPort(host, strconv.Itoa(port)))
+		if err != nil {
+			return "", err
+		}
+		resume = r
+	}
+
+	var detector *telnetDetector
+	if cfg.DetectTelnet {
+		detector = &telnetDetector{}
+	}
+
+	bell := newBellFilter(cfg)
+
+	if cfg.BreakOnStart {
+		if err := sendBreak(conn); err != nil {
+			return "", err
+		}
+	}
+	if cfg.BreakInterval > 0 {
+		go breaker(conn, cfg.BreakInterval, done, fail)
+	}
+	if cfg.Heartbeat > 0 {
+		go heartbeat(conn, cfg.Heartbeat, cfg.HeartbeatCheck, done, fail)
+	}
+
+	if canSplice(cfg) {
+		spliceIO(conn, finish)
+		<-done
+		conn.Close()
+		return reason, sessionErr
+	}
+
+	// Цепочка вывода строится только для обычного цикла: canSplice
+	// исключает все её звенья, а закрываются они в конце этой функции.
+	chain, err := newOutputChain(out, cfg)
+	if err != nil {
+		return "", err
+	}
+	out = chain
+	if chain.pager != nil {
+		// Выход из пейджера завершает сеанс сразу, не дожидаясь вывода сервера.
+		go func() {
+			<-chain.pagerDone()
+			finish(reasonPagerClosed, nil)
+		}()
+	}
+
+	// С --keep-on-stdout-error первая ошибка вывода запоминается и
+	// возвращается по окончании сеанса, а сам сеанс продолжается.
+	outputFailed := make(chan error, 1)
 
 	go func() {
 		buf := make([]byte, 1024)
 		for {
 			n, err := conn.Read(buf)
 			if n > 0 {
-				// Пишем ровно столько байт, сколько прочитали
-				if _, writeErr := os.Stdout.Write(buf[:n]); writeErr != nil {
-					closeDone()
-					return
+				data := buf[:n]
+				if detector != nil {
+					detector.feed(data)
+				}
+				// Дальше, в том числе для поиска приглашений, идут только
+				// данные: команды Telnet вырезаются, NUL после CR удаляется.
+				if negotiator != nil {
+					var reply []byte
+					if data, reply = negotiator.parse(data); len(reply) > 0 {
+						if _, err := conn.Write(reply); err != nil {
+							finish("write error: "+err.Error(), nil)
+							return
+						}
+					}
+				}
+				if more != nil && more.active.Load() {
+					var page bool
+					if data, page = more.strip(data); page {
+						if _, err := conn.Write([]byte{more.key}); err != nil {
+							finish("write error: "+err.Error(), nil)
+							return
+						}
+					}
+				}
+				if prompt != nil {
+					prompt.feed(data)
+				}
+				if bell != nil {
+					data = bell.filter(data)
+				}
+				if resume != nil {
+					data = resume.filter(data)
+				}
+				// Пишем ровно те байты, что остались после обработки
+				if _, writeErr := out.Write(data); writeErr != nil {
+					if chain.pagerClosed() {
+						return
+					}
+					if !cfg.KeepOnStdoutError {
+						fail(outputError(writeErr))
+						return
+					}
+					select {
+					case outputFailed <- outputError(writeErr):
+						fmt.Fprintf(os.Stderr, "warning: %v, discarding further output\n", outputError(writeErr))
+						out = io.Discard
+					default:
+					}
 				}
 			}
+			if err == io.EOF {
+				finish(reasonRemoteClosed, nil)
+				return
+			}
 			if err != nil {
-				closeDone()
+				finish("read error: "+err.Error(), nil)
 				return
 			}
 		}
 	}()
 
+	// Чтение ввода и запись в сокет развязаны очередью, чтобы заблокированная
+	// запись не останавливала чтение STDIN.
+	queue := newSendQueue(cfg.SendQueue, cfg.SendQueuePolicy)
+
+	go queue.send(conn, cfg, finish)
+
 	go func() {
+		defer queue.close()
+
+		if err := sendCommands(conn, cfg, prompt); err != nil {
+			fail(err)
+			return
+		}
+		if len(cfg.Commands) > 0 && cfg.ExitAfterCommands {
+			if cfg.WaitForClose {
+				// Закрытие очереди передаёт завершение писателю.
+				return
+			}
+			sendExit(conn, cfg)
+			finish(reasonCommandsDone, nil)
+			return
+		}
+		if err := waitPrompt(prompt, cfg); err != nil {
+			fail(err)
+			return
+		}
+		// Вывод последней команды может ещё идти постранично, поэтому
+		// приглашения --more перестают обрабатываться только после
+		// ожидания итогового приглашения.
+		if more != nil {
+			more.active.Store(false)
+		}
+		if chain.pager != nil && isTerminal(os.Stdin) {
+			// Пейджер сам читает клавиатуру, поэтому терминальный STDIN
+			// не читается, пока он открыт, а сеанс длится до выхода из
+			// пейджера или закрытия соединения. Ввод из канала или файла
+			// пересылается как обычно.
+			<-done
+			return
+		}
+
 		buf := make([]byte, 1024)
 		for {
-			n, err := os.Stdin.Read(buf)
+			n, err := in.Read(buf)
 			if n > 0 {
-				if _, writeErr := conn.Write(buf[:n]); writeErr != nil {
-					closeDone()
-					return
-				}
-			}
-			if err == io.EOF {
-				closeDone()
-				return
+				queue.push(prepareInput(buf[:n], cfg))
 			}
 			if err != nil {
-				closeDone()
 				return
 			}
 		}
@@ -118,21 +996,124 @@ func startIO(conn net.Conn) {
 
 	<-done
 	conn.Close()
+
+	if resume != nil {
+		if err := resume.save(); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+		}
+	}
+	if err := chain.close(); err != nil && sessionErr == nil {
+		sessionErr = err
+	}
+
+	select {
+	case err := <-outputFailed:
+		if sessionErr == nil {
+			sessionErr = err
+		}
+	default:
+	}
+	return reason, sessionErr
+}
+
+// prepareInput готовит фрагмент ввода к отправке: сначала заменяет байты
+// по --map, затем, без --raw, удваивает IAC. Поэтому байт, который --map
+// превратил в 0xFF, тоже уходит как данные, а сам 0xFF можно переназначить.
+func prepareInput(chunk []byte, cfg *Config) []byte {
+	cfg.InputMap.apply(chunk)
+	if !cfg.Raw {
+		chunk = escapeIAC(chunk)
+	}
+	return chunk
+}
+
+// waitPrompt ждёт приглашения сервера, если включён --wait-prompt.
+func waitPrompt(prompt *promptDetector, cfg *Config) error {
+	if prompt == nil {
+		return nil
+	}
+	return prompt.wait(cfg.PromptTimeout)
 }
 
 func main() {
-	cfg, err := parseArgs()
+	// Без этого запись в закрытый канал STDOUT убила бы процесс сигналом
+	// SIGPIPE; вместо этого она возвращает EPIPE и обрабатывается как ошибка.
+	signal.Ignore(syscall.SIGPIPE)
+
+	cfg, err := parseArgs(os.Args[1:])
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
 
-	conn, err := connect(cfg)
+	if cfg.Play != "" {
+		if err := play(cfg); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if cfg.TargetFromStdin {
+		if cfg.Host, cfg.Port, err = readTarget(os.Stdin); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	var conn net.Conn
+	switch {
+	case cfg.Serial != "":
+		conn, err = openSerial(cfg)
+	case cfg.Listen != 0:
+		conn, err = listen(cfg)
+	default:
+		conn, err = connect(cfg)
+	}
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
+	if cfg.Pcap != "" {
+		pc, err := newPcapConn(conn, cfg.Pcap)
+		if err != nil {
+			conn.Close()
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		conn = pc
+	}
+	if cfg.WriteTimeout > 0 {
+		conn = &writeTimeoutConn{Conn: conn, timeout: cfg.WriteTimeout}
+	}
 	defer conn.Close()
 
-	startIO(conn)
+	env := hookEnv(cfg, conn)
+	if cfg.OnConnect != "" {
+		runHook(cfg.OnConnect, env)
+	}
+
+	var reason string
+	switch {
+	case cfg.BannerOnly:
+		reason, err = printBanner(conn, cfg)
+	case cfg.Fetch != "":
+		reason, err = fetch(conn, cfg)
+	case cfg.Probe:
+		reason, err = probeOptions(conn, cfg)
+	case cfg.Ping:
+		reason, err = pingRTT(conn, cfg)
+	default:
+		reason, err = startIO(conn, cfg)
+	}
+	if cfg.OnDisconnect != "" {
+		if reason == "" {
+			reason = err.Error()
+		}
+		runHook(cfg.OnDisconnect, append(env, "GOTELNET_REASON="+reason))
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
 }
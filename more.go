@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sync/atomic"
+)
+
+// defaultMorePrompt совпадает с приглашениями постраничного вывода
+// вроде --More--, -- More (42%) --, --More--(42%), ---(more)---
+// и ---(more 42%)---.
+const defaultMorePrompt = `(?i) *-+\s*\(?\s*more\s*(\(?\d+%\)?)?\s*\)?\s*-+\s*(\(?\d+%\)?\s*)?`
+
+// moreResponder замечает приглашение постраничного вывода в конце потока,
+// чтобы клиент мог сам нажать --more-key. Пока active сброшен (например,
+// в интерактивной части сеанса), поток не трогается.
+type moreResponder struct {
+	re     *regexp.Regexp
+	key    byte
+	tail   []byte
+	active atomic.Bool
+}
+
+func newMoreResponder(pattern string, key byte) (*moreResponder, error) {
+	re, err := compileAnchored(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid more prompt pattern %q: %w", pattern, err)
+	}
+	return &moreResponder{re: re, key: key}, nil
+}
+
+// strip добавляет chunk к хвосту вывода и, если хвост оканчивается
+// приглашением, вырезает его из chunk и сообщает, что нужно отправить key.
+// Часть приглашения, пришедшая в предыдущих фрагментах, уже выведена
+// и остаётся как есть.
+func (m *moreResponder) strip(chunk []byte) ([]byte, bool) {
+	m.tail = append(m.tail, chunk...)
+	if over := len(m.tail) - promptTail; over > 0 {
+		m.tail = append(m.tail[:0], m.tail[over:]...)
+	}
+
+	i := matchEnd(m.re, m.tail)
+	if i < 0 {
+		return chunk, false
+	}
+
+	cut := max(0, len(chunk)-(len(m.tail)-i))
+	m.tail = m.tail[:0]
+	return chunk[:cut], true
+}
@@ -0,0 +1,35 @@
+package main
+
+import "testing"
+
+func TestDefaultMorePrompt(t *testing.T) {
+	tests := []struct {
+		output string
+		want   string // вывод после вырезания приглашения
+		page   bool
+	}{
+		{"line\r\n--More--", "line\r\n", true},
+		{"line\r\n -- More -- ", "line\r\n", true},
+		{"line\r\n-- More (42%) --", "line\r\n", true},
+		{"line\r\n--More--(42%)", "line\r\n", true},
+		{"line\r\n--More-- (42%) ", "line\r\n", true},
+		{"line\r\n---(more)---", "line\r\n", true},
+		{"line\r\n---(more 42%)---", "line\r\n", true},
+		{"line\r\n--more 42%--", "line\r\n", true},
+		{"line\r\n--More--\r\nnext", "line\r\n--More--\r\nnext", false},
+		{"more output", "more output", false},
+		{"Router#", "Router#", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.output, func(t *testing.T) {
+			m, err := newMoreResponder(defaultMorePrompt, ' ')
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, page := m.strip([]byte(tt.output))
+			if string(got) != tt.want || page != tt.page {
+				t.Errorf("strip(%q) = %q, %v; want %q, %v", tt.output, got, page, tt.want, tt.page)
+			}
+		})
+	}
+}
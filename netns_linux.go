@@ -0,0 +1,56 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"runtime"
+
+	"golang.org/x/sys/unix"
+)
+
+// netnsSupported сообщает, доступен ли --netns на этой платформе.
+const netnsSupported = true
+
+// dialInNetns вызывает dial в сетевом пространстве имён из файла path
+// (например, /var/run/netns/blue). Пространство имён принадлежит потоку ОС,
+// поэтому горутина закрепляется за потоком, поток переводится в нужное
+// пространство на время dial и затем возвращается в исходное. Сокет,
+// созданный внутри, остаётся в том пространстве, где был создан.
+func dialInNetns(path string, dial func() (net.Conn, error)) (net.Conn, error) {
+	target, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open network namespace: %w", err)
+	}
+	defer target.Close()
+
+	runtime.LockOSThread()
+
+	origin, err := os.Open(fmt.Sprintf("/proc/self/task/%d/ns/net", unix.Gettid()))
+	if err != nil {
+		runtime.UnlockOSThread()
+		return nil, fmt.Errorf("failed to open current network namespace: %w", err)
+	}
+	defer origin.Close()
+
+	if err := unix.Setns(int(target.Fd()), unix.CLONE_NEWNET); err != nil {
+		runtime.UnlockOSThread()
+		return nil, fmt.Errorf("failed to enter network namespace %s: %w", path, err)
+	}
+
+	conn, dialErr := dial()
+
+	if err := unix.Setns(int(origin.Fd()), unix.CLONE_NEWNET); err != nil {
+		// Поток остаётся в чужом пространстве имён, поэтому не отпускаем
+		// его: другие горутины не должны на нём выполняться.
+		if conn != nil {
+			conn.Close()
+		}
+		return nil, fmt.Errorf("failed to restore network namespace: %w", err)
+	}
+	runtime.UnlockOSThread()
+
+	return conn, dialErr
+}
@@ -0,0 +1,16 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+	"net"
+)
+
+// netnsSupported сообщает, доступен ли --netns на этой платформе.
+const netnsSupported = false
+
+// dialInNetns не поддерживается вне Linux.
+func dialInNetns(path string, dial func() (net.Conn, error)) (net.Conn, error) {
+	return nil, errors.New("network namespaces are only supported on Linux")
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"syscall"
+)
+
+// outputError оборачивает ошибку записи вывода, отдельно выделяя случай,
+// когда читатель на другом конце канала уже завершился (EPIPE).
+func outputError(err error) error {
+	if errors.Is(err, syscall.EPIPE) {
+		return fmt.Errorf("output closed by reader: %w", err)
+	}
+	return fmt.Errorf("failed to write output: %w", err)
+}
+
+// outputChain — звенья, через которые проходит вывод сервера, а при --play
+// и вывод записи: пейджер, внешняя команда --exec, пакетный сброс
+// --flush-interval и подавление повторов --squelch-repeats.
+type outputChain struct {
+	io.Writer
+
+	pager   *filter
+	exec    *filter
+	flusher *flushWriter
+	squelch *squelchWriter
+}
+
+// newOutputChain строит цепочку поверх out. Пейджер запускается, только
+// если STDOUT — терминал.
+func newOutputChain(out io.Writer, cfg *Config) (*outputChain, error) {
+	c := &outputChain{}
+
+	if cfg.Pager && isTerminal(os.Stdout) {
+		p, err := startPager(os.Stdout)
+		if err != nil {
+			return nil, err
+		}
+		c.pager = p
+		out = p
+	}
+	if cfg.Exec != "" {
+		f, err := startOutputFilter(cfg.Exec, out)
+		if err != nil {
+			c.close()
+			return nil, err
+		}
+		c.exec = f
+		out = f
+	}
+	if cfg.FlushInterval > 0 {
+		c.flusher = newFlushWriter(out, cfg.FlushInterval)
+		out = c.flusher
+	}
+	if cfg.SquelchRepeats {
+		c.squelch = newSquelchWriter(out, cfg.SquelchTimeout)
+		out = c.squelch
+	}
+
+	c.Writer = out
+	return c, nil
+}
+
+// pagerDone возвращает канал, закрываемый при выходе из пейджера, или nil,
+// если пейджера нет.
+func (c *outputChain) pagerDone() <-chan struct{} {
+	if c.pager == nil {
+		return nil
+	}
+	return c.pager.done
+}
+
+// pagerClosed сообщает, что ошибка записи вызвана выходом из пейджера.
+func (c *outputChain) pagerClosed() bool {
+	return c.pager != nil && pagerClosed(c.pager)
+}
+
+// close закрывает звенья, начиная с ближнего: сбрасывает буферы,
+// останавливает --exec и ждёт, пока пользователь выйдет из пейджера.
+// Возвращается первая ошибка сброса вывода.
+func (c *outputChain) close() error {
+	var err error
+	if c.squelch != nil {
+		if closeErr := c.squelch.close(); closeErr != nil {
+			err = outputError(closeErr)
+		}
+	}
+	if c.flusher != nil {
+		if closeErr := c.flusher.close(); closeErr != nil && err == nil {
+			err = outputError(closeErr)
+		}
+	}
+	if c.exec != nil {
+		c.exec.stop(filterGrace)
+	}
+	if c.pager != nil {
+		c.pager.wait()
+	}
+	return err
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"io"
+	"os"
+	"time"
+)
+
+// defaultPager используется, если переменная PAGER не задана.
+const defaultPager = "less -R"
+
+// isTerminal сообщает, подключён ли файл к терминалу.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// reasonPagerClosed — причина завершения сеанса, когда пользователь вышел
+// из пейджера.
+const reasonPagerClosed = "pager closed"
+
+// startPager запускает пейджер из $PAGER (по умолчанию less), выводящий в out.
+// Пейджер читает клавиатуру сам, с управляющего терминала, поэтому клиент
+// не читает STDIN, пока пейджер открыт, если STDIN — этот же терминал.
+func startPager(out io.Writer) (*filter, error) {
+	command := os.Getenv("PAGER")
+	if command == "" {
+		command = defaultPager
+	}
+	return startOutputFilter(command, out)
+}
+
+// pagerSharesStdin сообщает, что --pager будет читать клавиатуру с того же
+// терминала, что и STDIN: пейджер запускается только при терминальном STDOUT.
+func pagerSharesStdin() bool {
+	return isTerminal(os.Stdin) && isTerminal(os.Stdout)
+}
+
+// pagerClosed сообщает, что ошибка записи в пейджер вызвана выходом из него.
+// Запись в канал ломается, когда пейджер уже завершился, но cmd.Wait может
+// вернуться чуть позже, поэтому его завершения ждём не дольше filterGrace.
+func pagerClosed(p *filter) bool {
+	select {
+	case <-p.done:
+		return true
+	case <-time.After(filterGrace):
+		return false
+	}
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// Параметры формата pcap: связующий уровень LINKTYPE_RAW означает, что
+// каждый пакет начинается сразу с заголовка IP.
+const (
+	pcapMagic    = 0xa1b2c3d4
+	pcapSnapLen  = 65535
+	pcapLinkRaw  = 101
+	pcapMaxChunk = 65000
+)
+
+// Флаги заголовка TCP.
+const (
+	tcpFIN = 0x01
+	tcpSYN = 0x02
+	tcpPSH = 0x08
+	tcpACK = 0x10
+)
+
+// pcapConn записывает прикладные данные сеанса в файл pcap, достраивая
+// к ним заголовки IP и TCP с непрерывными номерами последовательности,
+// чтобы Wireshark мог собрать поток и разобрать его как telnet. В начало
+// файла пишется синтетическое тройное рукопожатие, при закрытии — FIN.
+type pcapConn struct {
+	net.Conn
+
+	mu     sync.Mutex
+	file   *os.File
+	w      *bufio.Writer
+	local  *net.TCPAddr
+	remote *net.TCPAddr
+	seqOut uint32 // следующий номер последовательности с нашей стороны
+	seqIn  uint32 // следующий номер последовательности со стороны сервера
+	ipID   uint16
+	err    error
+	once   sync.Once
+}
+
+// newPcapConn создаёт файл path и оборачивает conn так, чтобы все
+// прочитанные и записанные байты попадали в него.
+func newPcapConn(conn net.Conn, path string) (*pcapConn, error) {
+	local, okLocal := conn.LocalAddr().(*net.TCPAddr)
+	remote, okRemote := conn.RemoteAddr().(*net.TCPAddr)
+	if !okLocal || !okRemote {
+		return nil, fmt.Errorf("pcap capture requires a TCP connection")
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create pcap file: %w", err)
+	}
+
+	c := &pcapConn{
+		Conn:   conn,
+		file:   file,
+		w:      bufio.NewWriter(file),
+		local:  local,
+		remote: remote,
+		seqOut: 1000,
+		seqIn:  500000,
+	}
+
+	var header [24]byte
+	binary.LittleEndian.PutUint32(header[0:], pcapMagic)
+	binary.LittleEndian.PutUint16(header[4:], 2)
+	binary.LittleEndian.PutUint16(header[6:], 4)
+	binary.LittleEndian.PutUint32(header[16:], pcapSnapLen)
+	binary.LittleEndian.PutUint32(header[20:], pcapLinkRaw)
+	c.w.Write(header[:])
+
+	now := time.Now()
+	c.packet(now, true, tcpSYN, nil)
+	c.seqOut++
+	c.packet(now, false, tcpSYN|tcpACK, nil)
+	c.seqIn++
+	c.packet(now, true, tcpACK, nil)
+	if err := c.w.Flush(); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to write pcap file: %w", err)
+	}
+
+	return c, nil
+}
+
+func (c *pcapConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if n > 0 {
+		c.record(false, p[:n])
+	}
+	return n, err
+}
+
+func (c *pcapConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	if n > 0 {
+		c.record(true, p[:n])
+	}
+	return n, err
+}
+
+// Close закрывает соединение, дописывает FIN и закрывает файл.
+// Повторные вызовы безопасны.
+func (c *pcapConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.packet(time.Now(), true, tcpFIN|tcpACK, nil)
+		if flushErr := c.w.Flush(); flushErr != nil && c.err == nil {
+			c.err = flushErr
+		}
+		c.file.Close()
+		if c.err != nil {
+			fmt.Fprintf(os.Stderr, "warning: pcap capture incomplete: %v\n", c.err)
+		}
+	})
+	return err
+}
+
+// record записывает данные одного чтения или записи, разбивая их на
+// пакеты, которые помещаются в заголовок IP.
+func (c *pcapConn) record(outbound bool, data []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for len(data) > 0 {
+		chunk := data[:min(len(data), pcapMaxChunk)]
+		data = data[len(chunk):]
+		c.packet(now, outbound, tcpPSH|tcpACK, chunk)
+		if outbound {
+			c.seqOut += uint32(len(chunk))
+		} else {
+			c.seqIn += uint32(len(chunk))
+		}
+	}
+	if err := c.w.Flush(); err != nil && c.err == nil {
+		c.err = err
+	}
+}
+
+// packet собирает пакет IP/TCP с полезной нагрузкой payload и пишет его
+// в буфер вместе с заголовком записи pcap. Вызывается под c.mu.
+func (c *pcapConn) packet(ts time.Time, outbound bool, flags byte, payload []byte) {
+	src, dst := c.remote, c.local
+	seq, ack := c.seqIn, c.seqOut
+	if outbound {
+		src, dst = c.local, c.remote
+		seq, ack = c.seqOut, c.seqIn
+	}
+	if flags&tcpACK == 0 {
+		ack = 0
+	}
+
+	tcp := make([]byte, 20+len(payload))
+	binary.BigEndian.PutUint16(tcp[0:], uint16(src.Port))
+	binary.BigEndian.PutUint16(tcp[2:], uint16(dst.Port))
+	binary.BigEndian.PutUint32(tcp[4:], seq)
+	binary.BigEndian.PutUint32(tcp[8:], ack)
+	tcp[12] = 5 << 4
+	tcp[13] = flags
+	binary.BigEndian.PutUint16(tcp[14:], 65535)
+	copy(tcp[20:], payload)
+
+	var ip []byte
+	src4, dst4 := src.IP.To4(), dst.IP.To4()
+	if src4 != nil && dst4 != nil {
+		ip = make([]byte, 20)
+		ip[0] = 0x45
+		binary.BigEndian.PutUint16(ip[2:], uint16(20+len(tcp)))
+		c.ipID++
+		binary.BigEndian.PutUint16(ip[4:], c.ipID)
+		binary.BigEndian.PutUint16(ip[6:], 0x4000)
+		ip[8] = 64
+		ip[9] = 6
+		copy(ip[12:], src4)
+		copy(ip[16:], dst4)
+		binary.BigEndian.PutUint16(ip[10:], checksum(ip, 0))
+
+		pseudo := sum(src4, 0)
+		pseudo = sum(dst4, pseudo)
+		pseudo += 6 + uint32(len(tcp))
+		binary.BigEndian.PutUint16(tcp[16:], checksum(tcp, pseudo))
+	} else {
+		ip = make([]byte, 40)
+		ip[0] = 0x60
+		binary.BigEndian.PutUint16(ip[4:], uint16(len(tcp)))
+		ip[6] = 6
+		ip[7] = 64
+		copy(ip[8:], src.IP.To16())
+		copy(ip[24:], dst.IP.To16())
+
+		pseudo := sum(src.IP.To16(), 0)
+		pseudo = sum(dst.IP.To16(), pseudo)
+		pseudo += 6 + uint32(len(tcp))
+		binary.BigEndian.PutUint16(tcp[16:], checksum(tcp, pseudo))
+	}
+
+	length := uint32(len(ip) + len(tcp))
+	var record [16]byte
+	binary.LittleEndian.PutUint32(record[0:], uint32(ts.Unix()))
+	binary.LittleEndian.PutUint32(record[4:], uint32(ts.Nanosecond()/1000))
+	binary.LittleEndian.PutUint32(record[8:], length)
+	binary.LittleEndian.PutUint32(record[12:], length)
+
+	c.w.Write(record[:])
+	c.w.Write(ip)
+	c.w.Write(tcp)
+}
+
+// sum добавляет к частичной сумме 16-битные слова b для контрольной суммы.
+func sum(b []byte, acc uint32) uint32 {
+	for i := 0; i+1 < len(b); i += 2 {
+		acc += uint32(b[i])<<8 | uint32(b[i+1])
+	}
+	if len(b)%2 == 1 {
+		acc += uint32(b[len(b)-1]) << 8
+	}
+	return acc
+}
+
+// checksum вычисляет контрольную сумму интернета (RFC 1071) для b
+// с учётом начальной суммы acc.
+func checksum(b []byte, acc uint32) uint16 {
+	acc = sum(b, acc)
+	for acc>>16 != 0 {
+		acc = acc&0xffff + acc>>16
+	}
+	return ^uint16(acc)
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"os"
+	"time"
+)
+
+// reasonPingDone — причина завершения сеанса в режиме --ping-rtt.
+const reasonPingDone = "ping done"
+
+// pingReader читает ответы сервера в режиме --ping-rtt, отвечая на
+// переговоры Telnet. Ответом на пробу считаются данные, а без --raw также
+// WILL или WONT TIMING-MARK: так сервер отвечает на пробу IAC DO TIMING-MARK.
+type pingReader struct {
+	conn   net.Conn
+	parser *telnetParser // nil в режиме --raw
+	buf    []byte
+
+	// marked устанавливается, когда пришёл ответ на DO TIMING-MARK.
+	marked bool
+}
+
+// read ждёт данных до deadline. Истечение срока возвращается как ошибка
+// с Timeout() == true.
+func (r *pingReader) read(deadline time.Time) ([]byte, error) {
+	if err := r.conn.SetReadDeadline(deadline); err != nil {
+		return nil, fmt.Errorf("failed to set read deadline: %w", err)
+	}
+
+	n, err := r.conn.Read(r.buf)
+	data := r.buf[:n]
+	if n > 0 && r.parser != nil {
+		var reply []byte
+		data, reply = r.parser.parse(data)
+		if len(reply) > 0 {
+			if _, err := r.conn.Write(reply); err != nil {
+				return nil, fmt.Errorf("failed to answer negotiation: %w", err)
+			}
+		}
+	}
+	if err == io.EOF {
+		return data, fmt.Errorf("server closed the connection")
+	}
+	return data, err
+}
+
+// drain отбрасывает вывод сервера до deadline, чтобы остаток предыдущего
+// ответа не был принят за ответ на следующую пробу.
+func (r *pingReader) drain(deadline time.Time) error {
+	for {
+		_, err := r.read(deadline)
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// pingRTT --count раз отправляет --ping-send и измеряет время до первого
+// байта данных в ответ, как ping. Перед каждой пробой вывод сервера
+// отбрасывается в течение --ping-interval. Итог выводится в STDERR;
+// если сервер не ответил ни разу, возвращается ошибка.
+func pingRTT(conn net.Conn, cfg *Config) (string, error) {
+	r := &pingReader{conn: conn, buf: make([]byte, 1024)}
+	if !cfg.Raw {
+		r.parser = &telnetParser{
+			keepNulls: cfg.KeepNulls,
+			observe: func(verb, option byte) bool {
+				if option != optTimingMark || (verb != cmdWILL && verb != cmdWONT) {
+					return false
+				}
+				// Это ответ на нашу пробу, отвечать на него не нужно.
+				r.marked = true
+				return true
+			},
+		}
+	}
+
+	var rtts []time.Duration
+	for seq := 1; seq <= cfg.PingCount; seq++ {
+		if err := r.drain(time.Now().Add(cfg.PingInterval)); err != nil {
+			return "", err
+		}
+
+		r.marked = false
+		sent := time.Now()
+		if _, err := conn.Write(cfg.PingSend); err != nil {
+			return "", fmt.Errorf("failed to send probe: %w", err)
+		}
+
+		deadline := sent.Add(cfg.PingTimeout)
+		for {
+			data, err := r.read(deadline)
+			if len(data) > 0 || r.marked {
+				rtt := time.Since(sent)
+				rtts = append(rtts, rtt)
+				fmt.Fprintf(os.Stderr, "reply: seq=%d time=%s\n", seq, formatRTT(rtt))
+				break
+			}
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				fmt.Fprintf(os.Stderr, "no reply: seq=%d timeout=%v\n", seq, cfg.PingTimeout)
+				break
+			}
+			if err != nil {
+				return "", err
+			}
+		}
+	}
+
+	loss := 100 * (cfg.PingCount - len(rtts)) / cfg.PingCount
+	fmt.Fprintf(os.Stderr, "%d probes sent, %d replies, %d%% lost\n", cfg.PingCount, len(rtts), loss)
+	if len(rtts) == 0 {
+		return "", fmt.Errorf("no reply to %d probes", cfg.PingCount)
+	}
+	minRTT, avgRTT, maxRTT, jitter := rttStats(rtts)
+	fmt.Fprintf(os.Stderr, "rtt min/avg/max/jitter = %s/%s/%s/%s\n",
+		formatRTT(minRTT), formatRTT(avgRTT), formatRTT(maxRTT), formatRTT(jitter))
+	return reasonPingDone, nil
+}
+
+// rttStats считает минимум, среднее и максимум, а также джиттер — среднюю
+// разницу между соседними измерениями.
+func rttStats(rtts []time.Duration) (minRTT, avgRTT, maxRTT, jitter time.Duration) {
+	minRTT, maxRTT = rtts[0], rtts[0]
+	var sum, diffs time.Duration
+	for i, rtt := range rtts {
+		minRTT = min(minRTT, rtt)
+		maxRTT = max(maxRTT, rtt)
+		sum += rtt
+		if i > 0 {
+			diffs += time.Duration(math.Abs(float64(rtt - rtts[i-1])))
+		}
+	}
+	avgRTT = sum / time.Duration(len(rtts))
+	if len(rtts) > 1 {
+		jitter = diffs / time.Duration(len(rtts)-1)
+	}
+	return minRTT, avgRTT, maxRTT, jitter
+}
+
+// formatRTT выводит время в миллисекундах с точностью до микросекунды.
+func formatRTT(d time.Duration) string {
+	return fmt.Sprintf("%.3fms", float64(d)/float64(time.Millisecond))
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// castEvent — событие записи asciinema v2: [время, тип, данные].
+type castEvent struct {
+	at   time.Duration
+	kind string
+	data string
+}
+
+func (e *castEvent) UnmarshalJSON(b []byte) error {
+	var fields []json.RawMessage
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return err
+	}
+	if len(fields) != 3 {
+		return fmt.Errorf("expected 3 fields, got %d", len(fields))
+	}
+
+	var seconds float64
+	if err := json.Unmarshal(fields[0], &seconds); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(fields[1], &e.kind); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(fields[2], &e.data); err != nil {
+		return err
+	}
+	e.at = time.Duration(seconds * float64(time.Second))
+	return nil
+}
+
+// play выводит в STDOUT запись asciinema v2 из --play без подключения
+// к серверу, выдерживая исходные паузы, делённые на --speed. События до
+// --play-from выводятся сразу, чтобы экран пришёл в нужное состояние.
+// С --speed 0 каждый следующий кадр выводится после нажатия Enter.
+// Вывод проходит через те же фильтры и цепочку вывода, что и в сеансе.
+func play(cfg *Config) error {
+	f, err := os.Open(cfg.Play)
+	if err != nil {
+		return fmt.Errorf("failed to open recording: %w", err)
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	if !sc.Scan() {
+		return fmt.Errorf("%s: empty recording", cfg.Play)
+	}
+	var header struct {
+		Version int `json:"version"`
+	}
+	if err := json.Unmarshal(sc.Bytes(), &header); err != nil || header.Version != 2 {
+		return fmt.Errorf("%s: not an asciinema v2 recording", cfg.Play)
+	}
+
+	chain, err := newOutputChain(os.Stdout, cfg)
+	if err != nil {
+		return err
+	}
+	err = playEvents(sc, chain, cfg)
+	if closeErr := chain.close(); closeErr != nil && err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// playEvents выводит в out события записи, начиная со второй строки.
+// Выход из пейджера завершает воспроизведение без ошибки.
+func playEvents(sc *bufio.Scanner, out *outputChain, cfg *Config) error {
+	bell := newBellFilter(cfg)
+	step := bufio.NewReader(os.Stdin)
+	start := time.Now()
+	for line := 2; sc.Scan(); line++ {
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+		var ev castEvent
+		if err := json.Unmarshal(sc.Bytes(), &ev); err != nil {
+			return fmt.Errorf("%s:%d: invalid event: %w", cfg.Play, line, err)
+		}
+		if ev.kind != "o" {
+			continue
+		}
+
+		if ev.at >= cfg.PlayFrom {
+			if cfg.Speed == 0 {
+				if _, err := step.ReadString('\n'); err == io.EOF {
+					return nil
+				}
+			} else {
+				due := time.Duration(float64(ev.at-cfg.PlayFrom) / cfg.Speed)
+				select {
+				case <-time.After(time.Until(start.Add(due))):
+				case <-out.pagerDone():
+					return nil
+				}
+			}
+		}
+
+		data := []byte(ev.data)
+		if bell != nil {
+			data = bell.filter(data)
+		}
+		if _, err := out.Write(data); err != nil {
+			if out.pagerClosed() {
+				return nil
+			}
+			return outputError(err)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return fmt.Errorf("failed to read recording: %w", err)
+	}
+	return nil
+}
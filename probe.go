@@ -0,0 +1,126 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// defaultProbeOptions — опции, которые --probe-options проверяет по умолчанию.
+const defaultProbeOptions = "BINARY,ECHO,SGA,STATUS,TIMING-MARK,TTYPE,EOR,NAWS,TSPEED,LFLOW,LINEMODE,NEW-ENVIRON,CHARSET"
+
+// reasonProbeDone — причина завершения сеанса в режиме --probe-options.
+const reasonProbeDone = "probe done"
+
+// probeResult — ответы сервера на наши DO и WILL для одной опции.
+// Нулевое значение означает, что ответа не было.
+type probeResult struct {
+	remote byte // WILL или WONT в ответ на наш DO
+	local  byte // DO или DONT в ответ на наш WILL
+}
+
+// summary сводит ответы к одному слову для отчёта.
+func (r probeResult) summary() string {
+	switch {
+	case r.remote == cmdWILL && r.local == cmdDO:
+		return "agreed"
+	case r.remote == cmdWILL:
+		return "server-will"
+	case r.local == cmdDO:
+		return "server-do"
+	case r.remote == 0 && r.local == 0:
+		return "no-reply"
+	default:
+		return "refused"
+	}
+}
+
+// parseOptionList разбирает список опций через запятую.
+func parseOptionList(s string) ([]byte, error) {
+	var options []byte
+	for _, field := range strings.Split(s, ",") {
+		if strings.TrimSpace(field) == "" {
+			continue
+		}
+		option, err := parseOption(field)
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, option)
+	}
+	if len(options) == 0 {
+		return nil, fmt.Errorf("no telnet options to probe")
+	}
+	return options, nil
+}
+
+// probeOptions предлагает серверу каждую опцию из --probe-list в обе
+// стороны (DO и WILL), собирает первые ответы до --probe-timeout и выводит
+// в STDOUT по строке на опцию. Прочие запросы сервера отклоняются как обычно.
+func probeOptions(conn net.Conn, cfg *Config) (string, error) {
+	results := make(map[byte]*probeResult, len(cfg.ProbeOptions))
+	request := make([]byte, 0, len(cfg.ProbeOptions)*6)
+	for _, option := range cfg.ProbeOptions {
+		results[option] = &probeResult{}
+		request = append(request, cmdIAC, cmdDO, option, cmdIAC, cmdWILL, option)
+	}
+
+	pending := 2 * len(results)
+	parser := telnetParser{
+		observe: func(verb, option byte) bool {
+			r, ok := results[option]
+			if !ok {
+				return false
+			}
+			switch {
+			case (verb == cmdWILL || verb == cmdWONT) && r.remote == 0:
+				r.remote = verb
+			case (verb == cmdDO || verb == cmdDONT) && r.local == 0:
+				r.local = verb
+			default:
+				return false
+			}
+			pending--
+			return true
+		},
+	}
+
+	if _, err := conn.Write(request); err != nil {
+		return "", fmt.Errorf("failed to send probes: %w", err)
+	}
+	if err := conn.SetReadDeadline(time.Now().Add(cfg.ProbeTimeout)); err != nil {
+		return "", fmt.Errorf("failed to set read deadline: %w", err)
+	}
+
+	buf := make([]byte, 1024)
+	for pending > 0 {
+		n, err := conn.Read(buf)
+		if n > 0 {
+			_, reply := parser.parse(buf[:n])
+			if len(reply) > 0 {
+				if _, err := conn.Write(reply); err != nil {
+					return "", fmt.Errorf("failed to answer negotiation: %w", err)
+				}
+			}
+		}
+
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() || err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to read probe replies: %w", err)
+		}
+	}
+
+	for _, option := range cfg.ProbeOptions {
+		if _, err := fmt.Fprintf(os.Stdout, "%s: %s\n", optionName(option), results[option].summary()); err != nil {
+			return "", outputError(err)
+		}
+	}
+	return reasonProbeDone, nil
+}
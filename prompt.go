@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// promptTail — сколько последних байт вывода хранится для поиска приглашения.
+const promptTail = 512
+
+// promptDetector следит за концом вывода сервера и отмечает момент,
+// когда он совпадает с регулярным выражением приглашения. Поиск идёт
+// по ограниченному хвосту потока, а шаблон привязан к концу вывода.
+type promptDetector struct {
+	pattern string
+	re      *regexp.Regexp
+
+	mu      sync.Mutex
+	tail    []byte
+	ready   chan struct{}
+	history *outputTail // nil, если --dump-on-error выключен
+}
+
+func newPromptDetector(pattern string) (*promptDetector, error) {
+	re, err := compileAnchored(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid prompt pattern %q: %w", pattern, err)
+	}
+
+	return &promptDetector{
+		pattern: pattern,
+		re:      re,
+		tail:    make([]byte, 0, promptTail),
+		ready:   make(chan struct{}, 1),
+	}, nil
+}
+
+// feed добавляет очередной фрагмент вывода. Если хвост оканчивается
+// приглашением, хвост сбрасывается, а ожидающий wait пробуждается.
+func (d *promptDetector) feed(p []byte) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.history != nil {
+		d.history.write(p)
+	}
+	if len(p) >= promptTail {
+		d.tail = append(d.tail[:0], p[len(p)-promptTail:]...)
+	} else {
+		if over := len(d.tail) + len(p) - promptTail; over > 0 {
+			d.tail = append(d.tail[:0], d.tail[over:]...)
+		}
+		d.tail = append(d.tail, p...)
+	}
+
+	if matchEnd(d.re, d.tail) >= 0 {
+		d.tail = d.tail[:0]
+		select {
+		case d.ready <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// wait блокируется до появления приглашения, замеченного после
+// предыдущего вызова wait, но не дольше timeout. По истечении timeout
+// с --dump-on-error печатает последний вывод сервера.
+func (d *promptDetector) wait(timeout time.Duration) error {
+	select {
+	case <-d.ready:
+		return nil
+	case <-time.After(timeout):
+		if d.history != nil {
+			d.mu.Lock()
+			dumpOutput(d.history.buf, d.history.max, d.pattern)
+			d.mu.Unlock()
+		}
+		return promptTimeout(timeout, d.pattern)
+	}
+}
+
+// promptTimeout — ошибка, когда приглашение так и не появилось.
+func promptTimeout(timeout time.Duration, pattern string) error {
+	return fmt.Errorf("timed out after %v waiting for prompt %q", timeout, pattern)
+}
+
+// compileAnchored компилирует выражение, привязанное к концу текста.
+func compileAnchored(pattern string) (*regexp.Regexp, error) {
+	return regexp.Compile(`(?:` + pattern + `)\z`)
+}
+
+// matchEnd ищет совпадение привязанного к концу выражения re в последних
+// promptTail байтах p и возвращает позицию его начала или -1.
+func matchEnd(re *regexp.Regexp, p []byte) int {
+	offset := max(0, len(p)-promptTail)
+	loc := re.FindIndex(p[offset:])
+	if loc == nil {
+		return -1
+	}
+	return offset + loc[0]
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+)
+
+// Политики поведения очереди отправки при переполнении.
+const (
+	queueBlock = "block"
+	queueDrop  = "drop"
+)
+
+// sendQueue — ограниченная очередь между чтением STDIN и записью в сокет.
+// Пока сокет не принимает данные, ввод продолжает читаться, пока в очереди
+// есть место; дальше действует выбранная политика.
+type sendQueue struct {
+	ch   chan []byte
+	drop bool
+}
+
+func newSendQueue(size int, policy string) *sendQueue {
+	return &sendQueue{
+		ch:   make(chan []byte, size),
+		drop: policy == queueDrop,
+	}
+}
+
+// push ставит копию chunk в очередь. При политике drop переполненная
+// очередь отбрасывает фрагмент с предупреждением в STDERR, при block —
+// ждёт освобождения места.
+func (q *sendQueue) push(chunk []byte) {
+	chunk = append([]byte(nil), chunk...)
+	if !q.drop {
+		q.ch <- chunk
+		return
+	}
+
+	select {
+	case q.ch <- chunk:
+	default:
+		fmt.Fprintf(os.Stderr, "warning: send queue full, dropped %d bytes of input\n", len(chunk))
+	}
+}
+
+// close сообщает писателю, что новых данных не будет.
+func (q *sendQueue) close() {
+	close(q.ch)
+}
+
+// send пишет фрагменты из очереди в conn, пока очередь не закрыта, затем
+// отправляет --exit-send и завершает сеанс через finish. С --wait-for-close
+// сеанс завершает читающая сторона, когда сервер закроет соединение.
+// Ошибка записи завершает сеанс; истечение --write-timeout — с ошибкой.
+func (q *sendQueue) send(conn net.Conn, cfg *Config, finish func(string, error)) {
+	for chunk := range q.ch {
+		if n, err := conn.Write(chunk); err != nil {
+			if errors.Is(err, os.ErrDeadlineExceeded) {
+				finish(err.Error(), err)
+				return
+			}
+			finish(fmt.Sprintf("write error after %d of %d bytes: %v", n, len(chunk), err), nil)
+			return
+		}
+	}
+	sendExit(conn, cfg)
+	if cfg.WaitForClose {
+		if cfg.CloseWrite {
+			if err := closeWrite(conn); err != nil {
+				fmt.Fprintf(os.Stderr, "warning: failed to half-close connection: %v\n", err)
+			}
+		}
+		return
+	}
+	finish(reasonInputClosed, nil)
+}
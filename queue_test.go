@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// stalledServer читает из conn первые n байт, затем перестаёт читать до
+// закрытия resume и после этого дочитывает всё до конца. Прочитанное
+// отдаётся в канал по закрытии соединения.
+func stalledServer(conn net.Conn, n int, resume <-chan struct{}) <-chan []byte {
+	received := make(chan []byte, 1)
+	go func() {
+		first := make([]byte, n)
+		io.ReadFull(conn, first)
+		<-resume
+		rest, _ := io.ReadAll(conn)
+		received <- append(first, rest...)
+	}()
+	return received
+}
+
+// sessionEnd собирает вызовы finish, как startIO.
+type sessionEnd struct {
+	reasons chan string
+}
+
+func newSessionEnd() *sessionEnd {
+	return &sessionEnd{reasons: make(chan string, 1)}
+}
+
+func (e *sessionEnd) finish(why string, err error) {
+	select {
+	case e.reasons <- why:
+	default:
+	}
+}
+
+// wait ждёт завершения сеанса и возвращает его причину.
+func (e *sessionEnd) wait(t *testing.T) string {
+	t.Helper()
+	select {
+	case why := <-e.reasons:
+		return why
+	case <-time.After(5 * time.Second):
+		t.Fatal("session did not end")
+		return ""
+	}
+}
+
+// startSender запускает писателя очереди из startIO и закрывает conn
+// по окончании сеанса, чтобы сервер дочитал поток до конца.
+func startSender(t *testing.T, q *sendQueue, conn net.Conn) *sessionEnd {
+	end := newSessionEnd()
+	go q.send(conn, &Config{}, end.finish)
+	t.Cleanup(func() { conn.Close() })
+	return end
+}
+
+func queueChunk(i int) []byte {
+	return []byte(fmt.Sprintf("chunk%02d;", i))
+}
+
+func TestSendQueueBlocksWhileServerStalls(t *testing.T) {
+	client, server := net.Pipe()
+	resume := make(chan struct{})
+	received := stalledServer(server, len(queueChunk(0)), resume)
+
+	q := newSendQueue(2, queueBlock)
+	end := startSender(t, q, client)
+
+	const total = 10
+	pushed := make(chan struct{})
+	go func() {
+		for i := range total {
+			q.push(queueChunk(i))
+		}
+		close(pushed)
+	}()
+
+	select {
+	case <-pushed:
+		t.Fatal("all chunks were queued while the server was not reading")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(resume)
+	select {
+	case <-pushed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("push still blocked after the server resumed reading")
+	}
+	q.close()
+	if why := end.wait(t); why != reasonInputClosed {
+		t.Errorf("session ended with %q, want %q", why, reasonInputClosed)
+	}
+	client.Close()
+
+	var want []byte
+	for i := range total {
+		want = append(want, queueChunk(i)...)
+	}
+	if got := <-received; !bytes.Equal(got, want) {
+		t.Errorf("server received %q, want %q", got, want)
+	}
+}
+
+func TestSendQueueDropsWhileServerStalls(t *testing.T) {
+	client, server := net.Pipe()
+	resume := make(chan struct{})
+	received := stalledServer(server, len(queueChunk(0)), resume)
+
+	q := newSendQueue(2, queueDrop)
+	end := startSender(t, q, client)
+
+	const total = 10
+	pushed := make(chan struct{})
+	go func() {
+		for i := range total {
+			q.push(queueChunk(i))
+		}
+		close(pushed)
+	}()
+
+	select {
+	case <-pushed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("push blocked with the drop policy")
+	}
+	close(resume)
+	q.close()
+	if why := end.wait(t); why != reasonInputClosed {
+		t.Errorf("session ended with %q, want %q", why, reasonInputClosed)
+	}
+	client.Close()
+
+	got := <-received
+	if !bytes.HasPrefix(got, queueChunk(0)) {
+		t.Fatalf("server received %q, want it to start with %q", got, queueChunk(0))
+	}
+	if len(got) >= total*len(queueChunk(0)) {
+		t.Fatalf("server received all %d chunks, want some dropped", total)
+	}
+
+	// Дошедшие фрагменты идут по порядку и не повреждены.
+	last := -1
+	for rest := got; len(rest) > 0; rest = rest[len(queueChunk(0)):] {
+		var i int
+		if _, err := fmt.Sscanf(string(rest[:len(queueChunk(0))]), "chunk%02d;", &i); err != nil {
+			t.Fatalf("corrupted chunk in %q: %v", got, err)
+		}
+		if i <= last {
+			t.Fatalf("chunk %d arrived after chunk %d", i, last)
+		}
+		last = i
+	}
+}
+
+func TestSendQueueEndsSessionWhenServerGoesAway(t *testing.T) {
+	client, server := net.Pipe()
+	resume := make(chan struct{})
+	stalledServer(server, len(queueChunk(0)), resume)
+
+	q := newSendQueue(2, queueBlock)
+	end := startSender(t, q, client)
+
+	q.push(queueChunk(0))
+	q.push(queueChunk(1))
+	// Сервер перестал читать и закрыл соединение посреди передачи.
+	server.Close()
+
+	why := end.wait(t)
+	if !strings.HasPrefix(why, "write error after 0 of") {
+		t.Errorf("session ended with %q, want a write error", why)
+	}
+	close(resume)
+}
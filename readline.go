@@ -0,0 +1,62 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/chzyer/readline"
+)
+
+// lineReader читает ввод построчно с редактированием и историей команд.
+// Каждая завершённая строка отдаётся целиком вместе с CR LF.
+type lineReader struct {
+	rl      *readline.Instance
+	pending []byte
+}
+
+// newLineReader включает редактирование строки в терминале. Если задан
+// historyFile, история загружается из него и дописывается после каждой строки.
+func newLineReader(historyFile string) (*lineReader, error) {
+	if !isTerminal(os.Stdin) {
+		return nil, fmt.Errorf("--readline requires stdin to be a terminal")
+	}
+
+	rl, err := readline.NewEx(&readline.Config{
+		HistoryFile:     historyFile,
+		InterruptPrompt: "^C",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to start line editor: %w", err)
+	}
+
+	return &lineReader{rl: rl}, nil
+}
+
+func (r *lineReader) Read(p []byte) (int, error) {
+	for len(r.pending) == 0 {
+		line, err := r.rl.Readline()
+		if errors.Is(err, readline.ErrInterrupt) {
+			// Ctrl-C лишь сбрасывает набранную строку, как в оболочке.
+			continue
+		}
+		if err != nil {
+			return 0, io.EOF
+		}
+		r.pending = append([]byte(line), '\r', '\n')
+	}
+
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
+
+// Stdout возвращает STDOUT, запись в который не портит редактируемую строку.
+func (r *lineReader) Stdout() io.Writer {
+	return r.rl.Stdout()
+}
+
+func (r *lineReader) Close() error {
+	return r.rl.Close()
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// resumeSaveInterval — как часто --resume-state сохраняет счётчик во время
+// сеанса, чтобы он пережил и аварийное завершение клиента.
+const resumeSaveInterval = time.Second
+
+// resumeState хранит в файле, сколько байт вывода получено от устройства,
+// и при следующем подключении к нему же пропускает столько же байт.
+// В Telnet нет настоящего возобновления, поэтому это лишь приближение
+// для устройств, которые после переподключения повторяют вывод с начала.
+type resumeState struct {
+	path   string
+	target string
+
+	mu       sync.Mutex
+	skip     int64
+	total    int64
+	lastSave time.Time
+}
+
+// loadResume читает файл path. Счётчик, записанный для другого устройства,
+// не применяется; отсутствующий файл означает, что пропускать нечего.
+func loadResume(path, target string) (*resumeState, error) {
+	s := &resumeState{path: path, target: target, lastSave: time.Now()}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read resume state: %w", err)
+	}
+
+	saved, count, ok := strings.Cut(strings.TrimSpace(string(data)), " ")
+	n, err := strconv.ParseInt(count, 10, 64)
+	if !ok || err != nil || n < 0 {
+		return nil, fmt.Errorf("invalid resume state in %s", path)
+	}
+	if saved != target {
+		fmt.Fprintf(os.Stderr, "warning: resume state in %s is for %s, not %s; ignoring it\n", path, saved, target)
+		return s, nil
+	}
+
+	s.skip = n
+	if n > 0 {
+		fmt.Fprintf(os.Stderr, "warning: suppressing the first %d bytes from %s; telnet cannot resume, so this is best-effort\n", n, target)
+	}
+	return s, nil
+}
+
+// filter учитывает полученные данные и вырезает из них ещё не пропущенную
+// часть. Время от времени счётчик сохраняется в файл.
+func (s *resumeState) filter(data []byte) []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.total += int64(len(data))
+	if s.skip > 0 {
+		n := min(s.skip, int64(len(data)))
+		s.skip -= n
+		data = data[n:]
+	}
+
+	if time.Since(s.lastSave) >= resumeSaveInterval {
+		if err := s.write(); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+		}
+	}
+	return data
+}
+
+// save записывает счётчик в файл. Если соединение оборвалось раньше, чем
+// был пропущен весь прошлый вывод, сохраняется прежнее значение.
+func (s *resumeState) save() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.write()
+}
+
+func (s *resumeState) write() error {
+	s.lastSave = time.Now()
+	count := s.total + s.skip
+	content := fmt.Sprintf("%s %d\n", s.target, count)
+	if err := os.WriteFile(s.path, []byte(content), 0o644); err != nil {
+		return fmt.Errorf("failed to save resume state: %w", err)
+	}
+	return nil
+}
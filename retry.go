@@ -0,0 +1,49 @@
+package main
+
+import (
+	"errors"
+	"math/rand/v2"
+	"net"
+	"syscall"
+	"time"
+)
+
+// maxConnectBackoff ограничивает рост паузы между попытками подключения.
+const maxConnectBackoff = time.Minute
+
+// retryable сообщает, имеет ли смысл повторить подключение после err.
+// Повторяем только временные сбои: отказ в соединении, сброс, недоступный
+// хост и таймаут. Ошибки разрешения имён и неверные аргументы постоянны.
+func retryable(err error) bool {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return false
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	return errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.EHOSTUNREACH) ||
+		errors.Is(err, syscall.ENETUNREACH)
+}
+
+// backoff возвращает паузу перед попыткой attempt (начиная с 1): base,
+// удваиваемую с каждой попыткой до maxConnectBackoff, плюс случайную
+// добавку до половины этой величины, чтобы одновременно запущенные клиенты
+// не ломились на устройство в один и тот же момент.
+func backoff(base time.Duration, attempt int) time.Duration {
+	d := base
+	for i := 1; i < attempt && d < maxConnectBackoff; i++ {
+		d *= 2
+	}
+	d = min(d, maxConnectBackoff)
+
+	if half := int64(d / 2); half > 0 {
+		d += time.Duration(rand.Int64N(half))
+	}
+	return d
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"go.bug.st/serial"
+)
+
+// serialAddr — адрес последовательного порта для net.Conn.
+type serialAddr string
+
+func (a serialAddr) Network() string { return "serial" }
+func (a serialAddr) String() string  { return string(a) }
+
+// serialConn позволяет вести обычный сеанс поверх последовательного порта.
+// Срок чтения переводится в таймаут порта; срок записи порт не поддерживает.
+type serialConn struct {
+	serial.Port
+	name     string
+	deadline time.Time
+}
+
+// openSerial открывает последовательный порт с параметрами из флагов.
+func openSerial(cfg *Config) (net.Conn, error) {
+	mode := &serial.Mode{
+		BaudRate: cfg.Baud,
+		DataBits: cfg.DataBits,
+		Parity:   cfg.Parity,
+		StopBits: cfg.StopBits,
+	}
+
+	port, err := serial.Open(cfg.Serial, mode)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open serial port %s: %w", cfg.Serial, err)
+	}
+
+	return &serialConn{Port: port, name: cfg.Serial}, nil
+}
+
+// Read возвращает os.ErrDeadlineExceeded, если данные не пришли до срока,
+// установленного SetReadDeadline, — так же, как сетевое соединение.
+func (c *serialConn) Read(p []byte) (int, error) {
+	n, err := c.Port.Read(p)
+	if n == 0 && err == nil && !c.deadline.IsZero() {
+		return 0, os.ErrDeadlineExceeded
+	}
+	return n, err
+}
+
+// Write записывает p целиком. Порт может принять лишь часть байт без
+// ошибки, а net.Conn должен либо записать всё, либо вернуть ошибку.
+func (c *serialConn) Write(p []byte) (int, error) {
+	written := 0
+	for written < len(p) {
+		n, err := c.Port.Write(p[written:])
+		written += n
+		if err != nil {
+			return written, err
+		}
+		if n == 0 {
+			return written, io.ErrShortWrite
+		}
+	}
+	return written, nil
+}
+
+func (c *serialConn) LocalAddr() net.Addr  { return serialAddr(c.name) }
+func (c *serialConn) RemoteAddr() net.Addr { return serialAddr(c.name) }
+
+func (c *serialConn) SetDeadline(t time.Time) error {
+	return c.SetReadDeadline(t)
+}
+
+func (c *serialConn) SetReadDeadline(t time.Time) error {
+	c.deadline = t
+	if t.IsZero() {
+		return c.Port.SetReadTimeout(serial.NoTimeout)
+	}
+	return c.Port.SetReadTimeout(max(time.Until(t), time.Millisecond))
+}
+
+func (c *serialConn) SetWriteDeadline(t time.Time) error {
+	return fmt.Errorf("write deadlines are not supported on serial ports")
+}
+
+// parseParity разбирает значение --parity.
+func parseParity(s string) (serial.Parity, error) {
+	switch strings.ToLower(s) {
+	case "none", "n":
+		return serial.NoParity, nil
+	case "odd", "o":
+		return serial.OddParity, nil
+	case "even", "e":
+		return serial.EvenParity, nil
+	case "mark", "m":
+		return serial.MarkParity, nil
+	case "space", "s":
+		return serial.SpaceParity, nil
+	}
+	return 0, fmt.Errorf("invalid parity %q: expected none, odd, even, mark or space", s)
+}
+
+// parseStopBits разбирает значение --stopbits.
+func parseStopBits(s string) (serial.StopBits, error) {
+	switch s {
+	case "1":
+		return serial.OneStopBit, nil
+	case "1.5":
+		return serial.OnePointFiveStopBits, nil
+	case "2":
+		return serial.TwoStopBits, nil
+	}
+	return 0, fmt.Errorf("invalid stop bits %q: expected 1, 1.5 or 2", s)
+}
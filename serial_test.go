@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"go.bug.st/serial"
+)
+
+// trickleWritePort — последовательный порт, который принимает не больше
+// limit байт за вызов Write. После stallAfter принятых байт он перестаёт
+// принимать данные, но ошибки не возвращает.
+type trickleWritePort struct {
+	serial.Port
+	limit      int
+	stallAfter int
+	written    bytes.Buffer
+	calls      int
+}
+
+func (p *trickleWritePort) Write(b []byte) (int, error) {
+	p.calls++
+	n := min(len(b), p.limit)
+	if p.stallAfter > 0 {
+		n = min(n, p.stallAfter-p.written.Len())
+	}
+	p.written.Write(b[:n])
+	return n, nil
+}
+
+func TestSerialConnWriteCompletesShortWrites(t *testing.T) {
+	port := &trickleWritePort{limit: 3}
+	c := &serialConn{Port: port, name: "test"}
+
+	data := []byte("show running-config\r\n")
+	n, err := c.Write(data)
+	if err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if n != len(data) {
+		t.Errorf("Write returned %d, want %d", n, len(data))
+	}
+	if !bytes.Equal(port.written.Bytes(), data) {
+		t.Errorf("port received %q, want %q", port.written.Bytes(), data)
+	}
+	if want := (len(data) + 2) / 3; port.calls != want {
+		t.Errorf("port.Write called %d times, want %d", port.calls, want)
+	}
+}
+
+func TestSerialConnWriteReportsStall(t *testing.T) {
+	port := &trickleWritePort{limit: 3, stallAfter: 5}
+	c := &serialConn{Port: port, name: "test"}
+
+	n, err := c.Write([]byte("0123456789"))
+	if !errors.Is(err, io.ErrShortWrite) {
+		t.Fatalf("Write error = %v, want %v", err, io.ErrShortWrite)
+	}
+	if n != 5 {
+		t.Errorf("Write returned %d, want 5", n)
+	}
+	if got := port.written.String(); got != "01234" {
+		t.Errorf("port received %q, want %q", got, "01234")
+	}
+}
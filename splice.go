@@ -0,0 +1,62 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net"
+	"os"
+	"syscall"
+)
+
+// canSplice сообщает, что сеанс передаёт байты без каких-либо преобразований
+// (это возможно только в режиме --raw). В этом случае данные копируются через
+// io.Copy напрямую между соединением и файлами STDIN/STDOUT, и на Linux ядро
+// может перекладывать их через splice, минуя буферы пользовательского
+// пространства.
+func canSplice(cfg *Config) bool {
+	return cfg.Raw &&
+		cfg.Exec == "" &&
+		cfg.ExecInput == "" &&
+		!(cfg.Pager && isTerminal(os.Stdout)) &&
+		len(cfg.Commands) == 0 &&
+		!cfg.WaitPrompt &&
+		len(cfg.InputMap) == 0 &&
+		cfg.SendQueuePolicy == queueBlock &&
+		!cfg.KeepOnStdoutError &&
+		!cfg.Readline &&
+		cfg.Pcap == "" &&
+		len(cfg.ExitSend) == 0 &&
+		cfg.WriteTimeout == 0 &&
+		!cfg.WaitForClose &&
+		!cfg.NoBell &&
+		!cfg.RemapBell &&
+		cfg.ResumeState == "" &&
+		!cfg.SquelchRepeats &&
+		cfg.FlushInterval == 0 &&
+		!cfg.DetectTelnet
+}
+
+// spliceIO копирует данные в обе стороны через io.Copy и вызывает finish
+// с причиной, как только одно из направлений завершится.
+func spliceIO(conn net.Conn, finish func(string, error)) {
+	go func() {
+		if _, err := io.Copy(os.Stdout, conn); err != nil {
+			if errors.Is(err, syscall.EPIPE) {
+				err = outputError(err)
+				finish(err.Error(), err)
+				return
+			}
+			finish("copy error: "+err.Error(), nil)
+			return
+		}
+		finish(reasonRemoteClosed, nil)
+	}()
+
+	go func() {
+		if _, err := io.Copy(conn, os.Stdin); err != nil {
+			finish("copy error: "+err.Error(), nil)
+			return
+		}
+		finish(reasonInputClosed, nil)
+	}()
+}
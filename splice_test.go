@@ -0,0 +1,97 @@
+package main
+
+import (
+	"io"
+	"net"
+	"os"
+	"testing"
+)
+
+// benchTransferSize — сколько байт сервер отправляет за одну итерацию
+// бенчмарка сеанса.
+const benchTransferSize = 64 << 20
+
+// benchmarkSession измеряет сеанс startIO с настройками cfg: сервер на
+// loopback отправляет benchTransferSize байт и закрывает соединение,
+// а STDOUT — канал, который вычитывается, как при выводе в cat.
+func benchmarkSession(b *testing.B, cfg *Config) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer ln.Close()
+
+	payload := make([]byte, 64*1024)
+	for i := range payload {
+		payload[i] = 'a' + byte(i%26)
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			for sent := 0; sent < benchTransferSize; sent += len(payload) {
+				if _, err := conn.Write(payload); err != nil {
+					break
+				}
+			}
+			conn.Close()
+		}
+	}()
+
+	stdin, stdout := os.Stdin, os.Stdout
+	defer func() { os.Stdin, os.Stdout = stdin, stdout }()
+
+	outR, outW, err := os.Pipe()
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer outR.Close()
+	defer outW.Close()
+	go io.Copy(io.Discard, outR)
+	os.Stdout = outW
+
+	b.SetBytes(benchTransferSize)
+	b.ResetTimer()
+	for range b.N {
+		// Ввод не кончается до конца сеанса, чтобы его завершил сервер.
+		inR, inW, err := os.Pipe()
+		if err != nil {
+			b.Fatal(err)
+		}
+		os.Stdin = inR
+
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			b.Fatal(err)
+		}
+		reason, err := startIO(conn, cfg)
+		if err != nil || reason != reasonRemoteClosed {
+			b.Fatalf("session ended with %q, %v; want %q", reason, err, reasonRemoteClosed)
+		}
+
+		inW.Close()
+		inR.Close()
+	}
+}
+
+// BenchmarkSessionSplice измеряет вывод через io.Copy (--raw без
+// преобразований), который на Linux идёт через splice.
+func BenchmarkSessionSplice(b *testing.B) {
+	cfg := &Config{Raw: true, SendQueue: 64, SendQueuePolicy: queueBlock}
+	if !canSplice(cfg) {
+		b.Fatal("configuration does not take the splice path")
+	}
+	benchmarkSession(b, cfg)
+}
+
+// BenchmarkSessionBuffered измеряет тот же поток через обычный цикл
+// чтения по 1024 байта: политика drop отключает io.Copy.
+func BenchmarkSessionBuffered(b *testing.B) {
+	cfg := &Config{Raw: true, SendQueue: 64, SendQueuePolicy: queueDrop}
+	if canSplice(cfg) {
+		b.Fatal("configuration takes the splice path")
+	}
+	benchmarkSession(b, cfg)
+}
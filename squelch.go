@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// squelchMaxLine — строки длиннее этого не запоминаются и не схлопываются,
+// чтобы поток без переводов строки не копился в памяти.
+const squelchMaxLine = 4096
+
+// squelchWriter схлопывает подряд идущие одинаковые строки вывода для
+// --squelch-repeats: повтор не выводится, а вместо серии повторов
+// пишется строка "(repeated N times)", когда приходит другая строка или
+// проходит timeout. Незаконченная строка, которая может оказаться
+// повтором (совпадает с началом предыдущей), придерживается до перевода
+// строки или до timeout; любая другая выводится сразу.
+type squelchWriter struct {
+	out     io.Writer
+	timeout time.Duration
+
+	mu      sync.Mutex
+	last    []byte // последняя выведенная строка; nil, если она слишком длинная
+	line    []byte // начало текущей строки
+	passing bool   // текущая строка уже выводится как есть
+	long    bool   // текущая строка длиннее squelchMaxLine
+	repeats int
+	timer   *time.Timer
+	err     error
+}
+
+func newSquelchWriter(out io.Writer, timeout time.Duration) *squelchWriter {
+	s := &squelchWriter{out: out, timeout: timeout}
+	s.timer = time.AfterFunc(timeout, s.expire)
+	s.timer.Stop()
+	return s
+}
+
+func (s *squelchWriter) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := len(p)
+	for len(p) > 0 && s.err == nil {
+		chunk := p
+		i := bytes.IndexByte(p, '\n')
+		if i >= 0 {
+			chunk = p[:i+1]
+		}
+		p = p[len(chunk):]
+		s.feed(chunk, i >= 0)
+	}
+	if s.err != nil {
+		return 0, s.err
+	}
+	return n, nil
+}
+
+// feed обрабатывает часть строки; complete сообщает, что она закончена.
+func (s *squelchWriter) feed(chunk []byte, complete bool) {
+	if s.passing {
+		s.write(chunk)
+		s.track(chunk)
+	} else {
+		s.line = append(s.line, chunk...)
+		switch {
+		case complete && s.last != nil && bytes.Equal(s.line, s.last):
+			s.repeats++
+			s.line = s.line[:0]
+			s.timer.Reset(s.timeout)
+			return
+		case complete || s.last == nil || !bytes.HasPrefix(s.last, s.line):
+			s.flushRepeats()
+			s.write(s.line)
+			s.passing = true
+		default:
+			s.timer.Reset(s.timeout)
+			return
+		}
+	}
+
+	if complete {
+		s.last = nil
+		if !s.long && len(s.line) <= squelchMaxLine {
+			s.last = append([]byte(nil), s.line...)
+		}
+		s.line = s.line[:0]
+		s.passing = false
+		s.long = false
+	}
+}
+
+// track запоминает выведенную часть строки, пока она не слишком длинная.
+func (s *squelchWriter) track(chunk []byte) {
+	if s.long {
+		return
+	}
+	if len(s.line)+len(chunk) > squelchMaxLine {
+		s.long = true
+		s.line = s.line[:0]
+		return
+	}
+	s.line = append(s.line, chunk...)
+}
+
+// expire по таймеру выводит счётчик повторов и придержанное начало строки.
+func (s *squelchWriter) expire() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.flushHeld()
+}
+
+func (s *squelchWriter) flushHeld() {
+	s.flushRepeats()
+	if !s.passing && len(s.line) > 0 {
+		s.write(s.line)
+		s.passing = true
+	}
+}
+
+func (s *squelchWriter) flushRepeats() {
+	if s.repeats == 0 {
+		return
+	}
+	eol := "\n"
+	if bytes.HasSuffix(s.last, []byte("\r\n")) {
+		eol = "\r\n"
+	}
+	s.write([]byte(fmt.Sprintf("(repeated %d times)%s", s.repeats, eol)))
+	s.repeats = 0
+}
+
+func (s *squelchWriter) write(p []byte) {
+	if s.err == nil {
+		_, s.err = s.out.Write(p)
+	}
+}
+
+// close выводит всё придержанное. Возвращает первую ошибку записи.
+func (s *squelchWriter) close() error {
+	s.timer.Stop()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.flushHeld()
+	return s.err
+}
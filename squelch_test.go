@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+// squelchExpire в шагах теста означает срабатывание таймера.
+const squelchExpire = "<expire>"
+
+func TestSquelchWriter(t *testing.T) {
+	long := strings.Repeat("x", squelchMaxLine) + "\n"
+	tests := []struct {
+		name  string
+		steps []string
+		want  string // вывод после всех шагов, до close
+		final string // вывод после close
+	}{
+		{
+			name:  "distinct lines",
+			steps: []string{"a\nb\n"},
+			want:  "a\nb\n",
+			final: "a\nb\n",
+		},
+		{
+			name:  "repeats counted",
+			steps: []string{"a\na\na\nb\n"},
+			want:  "a\n(repeated 2 times)\nb\n",
+			final: "a\n(repeated 2 times)\nb\n",
+		},
+		{
+			name:  "CRLF counter line",
+			steps: []string{"a\r\na\r\nb\r\n"},
+			want:  "a\r\n(repeated 1 times)\r\nb\r\n",
+			final: "a\r\n(repeated 1 times)\r\nb\r\n",
+		},
+		{
+			name:  "repeats across writes",
+			steps: []string{"a\n", "a", "\n", "a\n"},
+			want:  "a\n",
+			final: "a\n(repeated 2 times)\n",
+		},
+		{
+			name:  "partial line held while it may repeat",
+			steps: []string{"abc\n", "ab"},
+			want:  "abc\n",
+			final: "abc\nab",
+		},
+		{
+			name:  "held line released by a different ending",
+			steps: []string{"abc\n", "ab", "x\n"},
+			want:  "abc\nabx\n",
+			final: "abc\nabx\n",
+		},
+		{
+			name:  "partial line that cannot repeat passes",
+			steps: []string{"abc\n", "x"},
+			want:  "abc\nx",
+			final: "abc\nx",
+		},
+		{
+			name:  "timeout flushes the counter",
+			steps: []string{"a\na\n", squelchExpire},
+			want:  "a\n(repeated 1 times)\n",
+			final: "a\n(repeated 1 times)\n",
+		},
+		{
+			// После сброса по таймеру строка остаётся последней выведенной,
+			// так что её следующий повтор снова только считается.
+			name:  "repeat after a timeout flush",
+			steps: []string{"a\na\n", squelchExpire, "a\n"},
+			want:  "a\n(repeated 1 times)\n",
+			final: "a\n(repeated 1 times)\n(repeated 1 times)\n",
+		},
+		{
+			name:  "timeout flushes a held partial line",
+			steps: []string{"abc\n", "ab", squelchExpire, "c\n"},
+			want:  "abc\nabc\n",
+			final: "abc\nabc\n",
+		},
+		{
+			name:  "long lines are not collapsed",
+			steps: []string{long, long},
+			want:  long + long,
+			final: long + long,
+		},
+		{
+			name:  "long lines written in pieces are not collapsed",
+			steps: []string{long[:10], long[10:], long[:10], long[10:]},
+			want:  long + long,
+			final: long + long,
+		},
+		{
+			name:  "close flushes the counter",
+			steps: []string{"a\na\n"},
+			want:  "a\n",
+			final: "a\n(repeated 1 times)\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			// Таймер не успевает сработать сам: срабатывание задают шаги.
+			s := newSquelchWriter(&out, time.Hour)
+			for _, step := range tt.steps {
+				if step == squelchExpire {
+					s.expire()
+					continue
+				}
+				if n, err := s.Write([]byte(step)); err != nil || n != len(step) {
+					t.Fatalf("Write(%q) = %d, %v", step, n, err)
+				}
+			}
+			if got := out.String(); got != tt.want {
+				t.Errorf("output before close = %q, want %q", got, tt.want)
+			}
+			if err := s.close(); err != nil {
+				t.Fatalf("close: %v", err)
+			}
+			if got := out.String(); got != tt.final {
+				t.Errorf("output after close = %q, want %q", got, tt.final)
+			}
+		})
+	}
+}
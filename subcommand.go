@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// Подкоманды. Без подкоманды аргументы разбираются как у connect, так что
+// прежние вызовы вида gotelnet [options] <host> <port> работают как раньше.
+const (
+	subConnect = "connect"
+	subServe   = "serve"
+	subSerial  = "serial"
+	subProbe   = "probe"
+)
+
+// subcommandUsage — строки использования для каждой подкоманды.
+var subcommandUsage = map[string]string{
+	subConnect: "[options] <host> <port>",
+	subServe:   "[options] <port>",
+	subSerial:  "[options] <device>",
+	subProbe:   "[options] <host> <port>",
+}
+
+// splitSubcommand отделяет подкоманду от остальных аргументов. explicit
+// сброшен, если подкоманда не указана и подразумевается connect.
+func splitSubcommand(args []string) (name string, rest []string, explicit bool) {
+	if len(args) > 0 {
+		if _, ok := subcommandUsage[args[0]]; ok {
+			return args[0], args[1:], true
+		}
+	}
+	return subConnect, args, false
+}
+
+// printUsage выводит использование подкоманды name или, если подкоманда
+// не указана явно, все формы вызова.
+func printUsage(name string, explicit bool) {
+	if explicit {
+		fmt.Fprintf(os.Stderr, "Usage: %s %s %s\n", os.Args[0], name, subcommandUsage[name])
+		return
+	}
+	fmt.Fprintf(os.Stderr, "Usage: %s [options] <host> <port>\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "       %s [options] --listen <port>\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "       %s [options] --serial <device>\n", os.Args[0])
+	for _, sub := range []string{subConnect, subServe, subSerial, subProbe} {
+		fmt.Fprintf(os.Stderr, "       %s %s %s\n", os.Args[0], sub, subcommandUsage[sub])
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+)
+
+// maxTargetLine ограничивает длину строки с адресом для --target-from-stdin.
+const maxTargetLine = 1024
+
+// readTarget читает из r первую строку и разбирает её как адрес сервера.
+// Чтение идёт по одному байту, чтобы ни один байт после перевода строки
+// не был прочитан заранее: остаток потока становится вводом сеанса.
+func readTarget(r io.Reader) (string, int, error) {
+	var line []byte
+	b := make([]byte, 1)
+	for {
+		n, err := r.Read(b)
+		if n > 0 {
+			if b[0] == '\n' {
+				break
+			}
+			if len(line) == maxTargetLine {
+				return "", 0, fmt.Errorf("target line longer than %d bytes", maxTargetLine)
+			}
+			line = append(line, b[0])
+		}
+		if err == io.EOF {
+			if len(line) == 0 {
+				return "", 0, errors.New("no target line on stdin")
+			}
+			break
+		}
+		if err != nil {
+			return "", 0, fmt.Errorf("failed to read target from stdin: %w", err)
+		}
+	}
+	return parseTarget(string(line))
+}
+
+// parseTarget разбирает адрес вида "host port" или "host:port"
+// (IPv6-адрес во второй форме берётся в квадратные скобки).
+func parseTarget(line string) (string, int, error) {
+	var host, port string
+	switch fields := strings.Fields(line); len(fields) {
+	case 1:
+		var err error
+		if host, port, err = net.SplitHostPort(fields[0]); err != nil {
+			return "", 0, fmt.Errorf("invalid target %q: %w", line, err)
+		}
+	case 2:
+		host, port = fields[0], fields[1]
+	default:
+		return "", 0, fmt.Errorf("invalid target %q: expected \"host port\" or \"host:port\"", line)
+	}
+	if host == "" {
+		return "", 0, fmt.Errorf("invalid target %q: empty host", line)
+	}
+
+	p, err := parsePort(port)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid target %q: %w", line, err)
+	}
+	return host, p, nil
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Команды протокола Telnet (RFC 854).
+const (
+	cmdSE   byte = 240
+	cmdNOP  byte = 241
+	cmdBRK  byte = 243
+	cmdSB   byte = 250
+	cmdWILL byte = 251
+	cmdWONT byte = 252
+	cmdDO   byte = 253
+	cmdDONT byte = 254
+	cmdIAC  byte = 255
+)
+
+// Опции Telnet, которые клиент обрабатывает сам.
+const (
+	// optTimingMark — опция TIMING-MARK (RFC 860). --ping-rtt принимает
+	// WILL или WONT в ответ на свой DO TIMING-MARK за ответ на пробу.
+	optTimingMark byte = 6
+
+	// optLogout — опция LOGOUT (RFC 727): сервер, приславший DO или WILL
+	// LOGOUT, завершает сеанс, и клиент закрывает соединение.
+	optLogout byte = 18
+
+	// optAuthentication — опция AUTHENTICATION (RFC 2941). Аутентификация
+	// не поддерживается: клиент только корректно от неё отказывается.
+	optAuthentication byte = 37
+)
+
+// Опции Telnet, известные клиенту по имени.
+var optionNames = map[byte]string{
+	0:  "BINARY",
+	1:  "ECHO",
+	3:  "SGA",
+	5:  "STATUS",
+	6:  "TIMING-MARK",
+	18: "LOGOUT",
+	24: "TTYPE",
+	25: "EOR",
+	31: "NAWS",
+	32: "TSPEED",
+	33: "LFLOW",
+	34: "LINEMODE",
+	35: "XDISPLOC",
+	36: "ENVIRON",
+	37: "AUTHENTICATION",
+	38: "ENCRYPT",
+	39: "NEW-ENVIRON",
+	42: "CHARSET",
+	44: "COM-PORT",
+}
+
+// optionName возвращает имя опции или её номер, если имя неизвестно.
+func optionName(option byte) string {
+	if name, ok := optionNames[option]; ok {
+		return name
+	}
+	return strconv.Itoa(int(option))
+}
+
+// parseOption разбирает опцию, заданную именем или номером.
+func parseOption(s string) (byte, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	for option, name := range optionNames {
+		if name == s {
+			return option, nil
+		}
+	}
+
+	n, err := strconv.ParseUint(s, 10, 8)
+	if err != nil {
+		return 0, fmt.Errorf("unknown telnet option %q", s)
+	}
+	return byte(n), nil
+}
+
+// Состояния разбора входящего потока.
+const (
+	stateData = iota
+	stateIAC
+	stateOption
+	stateSB
+	stateSBIAC
+)
+
+// telnetParser отделяет данные от команд Telnet во входящем потоке.
+// Клиент не поддерживает ни одной опции, поэтому на каждый DO отвечает
+// WONT, на каждый WILL — DONT, а субпереговоры пропускает целиком.
+// Состояние сохраняется между вызовами, так что команда может быть
+// разрезана на несколько фрагментов.
+//
+// Субпереговоры пропускаются по правилам кадрирования (до IAC SE, с учётом
+// удвоенных IAC), даже если сервер прислал их без согласования опции,
+// например AUTHENTICATION SEND после нашего WONT.
+//
+// NUL, следующий за CR, удаляется из данных, если не задан keepNulls.
+//
+// Если задан observe, он получает каждый принятый WILL, WONT, DO и DONT;
+// вернув true, он берёт ответ на себя, и автоматический отказ не посылается.
+type telnetParser struct {
+	state   int
+	verb    byte
+	observe func(verb, option byte) bool
+
+	// keepNulls отключает удаление NUL после CR (--keep-nulls).
+	keepNulls bool
+	cr        bool
+}
+
+// parse разбирает очередной фрагмент и возвращает данные для вывода
+// и ответы, которые нужно отправить серверу.
+func (p *telnetParser) parse(in []byte) (data, reply []byte) {
+	data = make([]byte, 0, len(in))
+
+	for _, b := range in {
+		switch p.state {
+		case stateData:
+			if b == cmdIAC {
+				p.state = stateIAC
+				continue
+			}
+			// По правилам NVT одиночный CR передаётся как CR NUL.
+			if b == 0 && p.cr && !p.keepNulls {
+				p.cr = false
+				continue
+			}
+			p.cr = b == '\r'
+			data = append(data, b)
+
+		case stateIAC:
+			switch b {
+			case cmdIAC:
+				data = append(data, cmdIAC)
+				p.cr = false
+				p.state = stateData
+			case cmdWILL, cmdWONT, cmdDO, cmdDONT:
+				p.verb = b
+				p.state = stateOption
+			case cmdSB:
+				p.state = stateSB
+			default:
+				p.state = stateData
+			}
+
+		case stateOption:
+			if p.observe != nil && p.observe(p.verb, b) {
+				p.state = stateData
+				continue
+			}
+			switch p.verb {
+			case cmdDO:
+				reply = append(reply, cmdIAC, cmdWONT, b)
+			case cmdWILL:
+				reply = append(reply, cmdIAC, cmdDONT, b)
+			}
+			p.state = stateData
+
+		case stateSB:
+			if b == cmdIAC {
+				p.state = stateSBIAC
+			}
+
+		case stateSBIAC:
+			if b == cmdSE {
+				p.state = stateData
+			} else {
+				p.state = stateSB
+			}
+		}
+	}
+
+	return data, reply
+}
+
+// escapeIAC удваивает каждый байт IAC в исходящих данных, чтобы сервер
+// принял его как данные, а не как начало команды. Если IAC не встречается,
+// возвращается исходный срез.
+func escapeIAC(p []byte) []byte {
+	count := 0
+	for _, b := range p {
+		if b == cmdIAC {
+			count++
+		}
+	}
+	if count == 0 {
+		return p
+	}
+
+	escaped := make([]byte, 0, len(p)+count)
+	for _, b := range p {
+		if b == cmdIAC {
+			escaped = append(escaped, cmdIAC)
+		}
+		escaped = append(escaped, b)
+	}
+	return escaped
+}
+
+// newSessionParser возвращает разборщик для интерактивного сеанса. Он
+// отказывается от AUTHENTICATION, без чего krb5-telnetd зависает
+// в переговорах, на DO или WILL LOGOUT вызывает logout, а остальные
+// команды, как и раньше, оставляет без ответа.
+func newSessionParser(logout func()) *telnetParser {
+	return &telnetParser{
+		observe: func(verb, option byte) bool {
+			switch option {
+			case optAuthentication:
+				return false
+			case optLogout:
+				if verb == cmdDO || verb == cmdWILL {
+					logout()
+				}
+			}
+			return true
+		},
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestEscapeIAC(t *testing.T) {
+	tests := []struct {
+		name string
+		in   []byte
+		want []byte
+	}{
+		{"no IAC", []byte("show run\r\n"), []byte("show run\r\n")},
+		{"single IAC", []byte{'a', 0xff, 'b'}, []byte{'a', 0xff, 0xff, 'b'}},
+		{"only IAC", []byte{0xff, 0xff}, []byte{0xff, 0xff, 0xff, 0xff}},
+		{"other high bytes", []byte{0xfe, 0xf0}, []byte{0xfe, 0xf0}},
+		{"empty", []byte{}, []byte{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := escapeIAC(tt.in); !bytes.Equal(got, tt.want) {
+				t.Errorf("escapeIAC(%v) = %v, want %v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrepareInputMapsBeforeEscaping(t *testing.T) {
+	tests := []struct {
+		name  string
+		input []byte
+		m     byteMap
+		raw   bool
+		want  []byte
+	}{
+		{"IAC escaped", []byte{'a', 0xff}, byteMap{}, false, []byte{'a', 0xff, 0xff}},
+		{"mapped to IAC is escaped", []byte{0x7f}, byteMap{0x7f: 0xff}, false, []byte{0xff, 0xff}},
+		{"IAC mapped away is not escaped", []byte{0xff}, byteMap{0xff: 0x08}, false, []byte{0x08}},
+		{"map does not see escaping", []byte{0xff}, byteMap{0xff: 0xff}, false, []byte{0xff, 0xff}},
+		{"raw mapped to IAC", []byte{0x7f}, byteMap{0x7f: 0xff}, true, []byte{0xff}},
+		{"raw IAC", []byte{0xff, 'x'}, byteMap{}, true, []byte{0xff, 'x'}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{InputMap: tt.m, Raw: tt.raw}
+			in := append([]byte(nil), tt.input...)
+			if got := prepareInput(in, cfg); !bytes.Equal(got, tt.want) {
+				t.Errorf("prepareInput(%v) = %v, want %v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTelnetParserDropsNulAfterCR(t *testing.T) {
+	tests := []struct {
+		name      string
+		chunks    []string
+		keepNulls bool
+		want      string
+	}{
+		{"CR NUL", []string{"a\r\x00b"}, false, "a\rb"},
+		{"CR NUL split across reads", []string{"a\r", "\x00b"}, false, "a\rb"},
+		{"CR LF", []string{"a\r\nb"}, false, "a\r\nb"},
+		{"NUL without CR", []string{"\x00a\x00"}, false, "\x00a\x00"},
+		{"only the first NUL", []string{"\r\x00\x00"}, false, "\r\x00"},
+		{"CR as option number", []string{"\xff\xfb\r\x00"}, false, "\x00"},
+		{"CR as option number split", []string{"\xff\xfb", "\r", "\x00"}, false, "\x00"},
+		{"CR inside subnegotiation", []string{"\xff\xfa\x18\r\xff\xf0\x00"}, false, "\x00"},
+		{"command between CR and NUL", []string{"\r\xff\xf1\x00"}, false, "\r"},
+		{"IAC IAC after CR", []string{"\r\xff\xff\x00"}, false, "\r\xff\x00"},
+		{"IAC IAC split", []string{"\r\xff", "\xff", "\x00"}, false, "\r\xff\x00"},
+		{"keep nulls", []string{"a\r", "\x00b"}, true, "a\r\x00b"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &telnetParser{keepNulls: tt.keepNulls}
+			var got []byte
+			for _, chunk := range tt.chunks {
+				data, _ := p.parse([]byte(chunk))
+				got = append(got, data...)
+			}
+			if string(got) != tt.want {
+				t.Errorf("parse(%q) = %q, want %q", tt.chunks, got, tt.want)
+			}
+		})
+	}
+}